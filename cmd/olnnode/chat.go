@@ -2,79 +2,82 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/nats-io/nats.go"
-
 	"github.com/lapingvino/eolnpoc/location"
+	"github.com/lapingvino/eolnpoc/node"
 	"github.com/lapingvino/eolnpoc/olnjson"
-	"github.com/lapingvino/eolnpoc/pow"
-)
-
-const (
-	maxHops            = 3
-	defaultMaxCache    = 100
-	defaultRebroadcast = 5 * time.Minute
-	ttlDays            = 7
+	"github.com/lapingvino/eolnpoc/parser"
+	"github.com/lapingvino/eolnpoc/signing"
+	"github.com/lapingvino/eolnpoc/trust"
 )
 
-// MessageEntry wraps a message with metadata for prioritization
-type MessageEntry struct {
-	Hash           string
-	Message        olnjson.Message
-	Priority       int
-	PoWBits        int
-	Plustags       []string // Extracted location codes
-	ProximityScore int      // Based on user's location
-	FirstSeen      time.Time
-	LastSent       time.Time
+// chat is the interactive front end of a node.
+type chat struct {
+	node *node.Node
 }
 
-// ChatFilters defines user preferences
-type ChatFilters struct {
-	Hashtags  []string
-	Locations []string
+func chatCommand(natsURL string, args []string) {
+	runNode("chat", natsURL, args)
 }
 
-// ChatState manages the chat session state
-type ChatState struct {
-	Cache               map[string]*MessageEntry
-	Filters             ChatFilters
-	NC                  *nats.Conn
-	MaxCacheSize        int
-	RebroadcastInterval time.Duration
-	AutoPoWBits         int
-	mu                  sync.RWMutex
-	stopChan            chan bool
+func serveCommand(natsURL string, args []string) {
+	runNode("serve", natsURL, args)
 }
 
-func chatCommand(natsURL string, args []string) {
-	fs := flag.NewFlagSet("chat", flag.ContinueOnError)
+// runNode runs a caching node: interactively for chat, headless for serve.
+func runNode(mode, natsURL string, args []string) {
+	interactive := mode == "chat"
+
+	fs := flag.NewFlagSet(mode, flag.ContinueOnError)
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: olnnode chat [options]\n")
+		fmt.Fprintf(os.Stderr, "Usage: olnnode %s [options]\n", mode)
 		fs.PrintDefaults()
 	}
 
-	var tags, locations, server string
+	var tags, locations, rulesPath, server, keyPath, identity, storeDir, contactsPath, sigPolicy string
+	var httpAddr, name, link, feeds, crawl, push string
+	var acceptPush bool
+	var pushMinPoW int
+	var crawlInterval time.Duration
 	var maxCache int
 	var rebroadcast string
 	var autoPow int
+	var radius float64
 
 	fs.StringVar(&tags, "tag", "", "Comma-separated hashtags to filter (e.g., #OLN,#test)")
 	fs.StringVar(&locations, "location", "", "Location filter (pluscode format)")
-	fs.IntVar(&maxCache, "max-cache", defaultMaxCache, "Max messages to cache")
-	fs.StringVar(&rebroadcast, "rebroadcast", "5m", "Rebroadcast interval")
+	fs.StringVar(&rulesPath, "rules", "", "File with rules for messages to hide")
+	fs.IntVar(&maxCache, "max-cache", node.DefaultMaxCache, "Max messages to cache")
+	fs.StringVar(&rebroadcast, "rebroadcast", "5m", "How often to exchange cache summaries with other nodes")
 	fs.IntVar(&autoPow, "auto-pow", 0, "Auto-apply N-bit PoW to all messages")
+	fs.Float64Var(&radius, "radius", location.DefaultProximityRadius, "Distance in metres within which locations count as nearby")
 	fs.StringVar(&server, "server", "", "NATS server URL")
+	fs.StringVar(&keyPath, "key", defaultKeyPath(), "Identity key file")
+	fs.StringVar(&identity, "identity", "", "Keystore identity to send as, instead of --key")
+	fs.StringVar(&storeDir, "keystore", "", "Identity directory (default: "+defaultKeystore()+")")
+	fs.StringVar(&contactsPath, "contacts", defaultContactsPath(), "Contact list file")
+	fs.StringVar(&sigPolicy, "sig-policy", "flag", "Signature policy: flag, drop-forged or drop-unsigned")
+	fs.StringVar(&name, "name", "OLN Node", "Server name announced in published documents")
+	fs.StringVar(&link, "link", "oln.local", "Public URL of this node's feed")
+	fs.StringVar(&feeds, "feeds", "", "Comma-separated URLs of other feeds to announce")
+	fs.StringVar(&crawl, "crawl", "", "Comma-separated feed URLs to crawl for messages in the background")
+	fs.DurationVar(&crawlInterval, "crawl-interval", node.DefaultCrawlInterval, "How often to crawl the --crawl feeds")
+	fs.StringVar(&push, "push", "", "Comma-separated push URLs of nodes to send our messages to")
+	fs.BoolVar(&acceptPush, "accept-push", false, "Accept messages POSTed to the HTTP feed")
+	fs.IntVar(&pushMinPoW, "push-min-pow", 0, "PoW bits required on pushed messages")
+	if interactive {
+		fs.StringVar(&httpAddr, "http", "", "Also serve the feed over HTTP on this address (e.g. :8080)")
+	} else {
+		fs.StringVar(&httpAddr, "http", defaultHTTPAddr, "Address to serve the feed on")
+	}
 
 	if err := fs.Parse(args); err != nil {
 		os.Exit(1)
@@ -91,380 +94,134 @@ func chatCommand(natsURL string, args []string) {
 	}
 
 	// Parse filters
-	var hashtags []string
-	if tags != "" {
-		for _, tag := range strings.Split(tags, ",") {
-			tag = strings.TrimSpace(tag)
-			if tag != "" {
-				hashtags = append(hashtags, tag)
-			}
-		}
-	}
+	hashtags := splitList(tags)
+	locFilters := splitList(locations)
 
-	var locFilters []string
-	if locations != "" {
-		for _, loc := range strings.Split(locations, ",") {
-			loc = strings.TrimSpace(loc)
-			if loc != "" {
-				locFilters = append(locFilters, loc)
-			}
+	// Unlock the identity before connecting, the passphrase may take a while
+	key, origin := chooseIdentity(keyPath, storeDir, identity)
+
+	var rules node.Rules
+	if rulesPath != "" {
+		if rules, err = node.LoadRules(rulesPath); err != nil {
+			log.Fatalf("Failed to load rules: %v", err)
 		}
 	}
 
-	// Create chat state
-	state := &ChatState{
-		Cache:               make(map[string]*MessageEntry),
-		Filters:             ChatFilters{Hashtags: hashtags, Locations: locFilters},
-		MaxCacheSize:        maxCache,
-		RebroadcastInterval: rebroadcastDur,
-		AutoPoWBits:         autoPow,
-		stopChan:            make(chan bool),
+	contacts, err := trust.Load(contactsPath)
+	if err != nil {
+		log.Fatalf("Failed to load contacts: %v", err)
 	}
 
 	// Connect to NATS
-	nc := connectNATS(server)
-	defer nc.Close()
-	state.NC = nc
-
-	fmt.Printf("OLN Chat Mode (%s)\n", server)
-	if len(hashtags) > 0 {
-		fmt.Printf("Hashtag filters: %s\n", strings.Join(hashtags, ", "))
-	}
-	if len(locFilters) > 0 {
-		fmt.Printf("Location filters: %s\n", strings.Join(locFilters, ", "))
-	}
-	fmt.Println("Type messages and press Enter to send. Type !help for commands. Ctrl+C to exit.")
-	fmt.Println(strings.Repeat("-", 60))
-
-	// Start message receiver
-	go state.messageReceiver()
-
-	// Start rebroadcast timer
-	go state.rebroadcastLoop()
-
-	// Start cleanup timer
-	go state.cleanupLoop()
-
-	// Start input handler
-	state.handleInput()
-
-	// Cleanup
-	close(state.stopChan)
-}
-
-func (s *ChatState) messageReceiver() {
-	sub, err := s.NC.Subscribe(natsSubject, func(m *nats.Msg) {
-		var format olnjson.Format
-		if err := json.Unmarshal(m.Data, &format); err != nil {
-			return
-		}
-
-		for hash, msg := range format.Messages {
-			s.addMessage(hash, msg)
-		}
-	})
+	t := connectNATS(server)
+	defer t.Close()
+
+	c := &chat{}
+	opts := node.Options{
+		Transport:       t,
+		Key:             key,
+		Origin:          origin,
+		Filters:         node.Filters{Hashtags: hashtags, Locations: locFilters},
+		Rules:           rules,
+		MaxCacheSize:    maxCache,
+		SyncInterval:    rebroadcastDur,
+		AutoPoWBits:     autoPow,
+		ProximityRadius: radius,
+		SigPolicy:       parseSigPolicy(sigPolicy),
+		Contacts:        contacts,
+		Name:            name,
+		Link:            link,
+		Feeds:           splitList(feeds),
+		Push:            splitList(push),
+		AcceptPush:      acceptPush,
+		PushMinPoW:      pushMinPoW,
+		Crawl:           splitList(crawl),
+		CrawlInterval:   crawlInterval,
+	}
+	if interactive {
+		opts.OnMessage = c.displayMessage
+	}
+	n, err := node.New(opts)
 	if err != nil {
-		log.Fatalf("Failed to subscribe: %v", err)
-	}
-	defer sub.Unsubscribe()
-
-	<-s.stopChan
-}
-
-func (s *ChatState) addMessage(hash string, msg olnjson.Message) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Skip if already cached
-	if _, exists := s.Cache[hash]; exists {
-		return
+		log.Fatalf("Failed to create node: %v", err)
 	}
+	c.node = n
 
-	// Detect PoW
-	powBits := s.detectPoW(msg.Raw)
-
-	// Extract plustags (both direct and from #geo hashtags)
-	plustags := location.AllPlustags(msg.Raw)
-
-	// Calculate proximity score
-	proximityScore := 0
-	if len(s.Filters.Locations) > 0 && len(plustags) > 0 {
-		// Use the best proximity score among all message locations
-		for _, msgLoc := range plustags {
-			for _, userLoc := range s.Filters.Locations {
-				score := location.CalculateProximity(msgLoc, userLoc)
-				if score > proximityScore {
-					proximityScore = score
-				}
-			}
-		}
-	}
-
-	// Calculate priority
-	priority := s.calculatePriority(msg, powBits, proximityScore)
-
-	entry := &MessageEntry{
-		Hash:           hash,
-		Message:        msg,
-		Priority:       priority,
-		PoWBits:        powBits,
-		Plustags:       plustags,
-		ProximityScore: proximityScore,
-		FirstSeen:      time.Now(),
-		LastSent:       time.Now(),
-	}
-
-	s.Cache[hash] = entry
-
-	// Display message
-	s.displayMessage(hash, entry)
-
-	// Evict lowest priority if cache is full
-	if len(s.Cache) > s.MaxCacheSize {
-		s.evictLowestPriority()
-	}
-}
-
-func (s *ChatState) displayMessage(hash string, entry *MessageEntry) {
-	msg := entry.Message
-	indicator := ""
-
-	if s.matchesFilters(msg) {
-		indicator = " [★]"
-	}
-
-	// Location indicator
-	if entry.ProximityScore > 0 {
-		if entry.ProximityScore >= 500 {
-			indicator += " [📍 exact]"
-		} else if entry.ProximityScore >= 250 {
-			indicator += " [📍 nearby]"
-		} else {
-			indicator += " [📍 region]"
-		}
-	}
-
-	if entry.PoWBits > 0 {
-		indicator += fmt.Sprintf(" [PoW:%d]", entry.PoWBits)
-	}
-
-	fmt.Printf("\n[%s] %s%s\n", msg.Timestamp.Format("2006-01-02 15:04:05"), hash[:8], indicator)
-
-	// Show all tags including plustags
-	allTags := msg.Tags
-	for _, plustag := range entry.Plustags {
-		// Check if plustag is already in tags
-		found := false
-		for _, t := range allTags {
-			if t == plustag {
-				found = true
-				break
-			}
-		}
-		if !found {
-			allTags = append(allTags, plustag)
-		}
-	}
-
-	if len(allTags) > 0 {
-		fmt.Printf("  Tags: %s\n", strings.Join(allTags, ", "))
+	if interactive {
+		fmt.Printf("OLN Chat Mode (%s)\n", server)
+	} else {
+		fmt.Printf("OLN Node (%s)\n", server)
 	}
-	if msg.Origin.Display != "" {
-		fmt.Printf("  From: %s\n", msg.Origin.Display)
+	if origin.Display != "" {
+		fmt.Printf("Identity: %s (%s)\n", n.PubKey(), origin.Display)
+	} else {
+		fmt.Printf("Identity: %s\n", n.PubKey())
 	}
-	fmt.Printf("  %s\n", msg.Raw)
-	fmt.Print("> ")
-}
-
-func (s *ChatState) calculatePriority(msg olnjson.Message, powBits int, proximityScore int) int {
-	priority := 100 // BaseScore
-
-	// FilterBonus
-	if s.matchesFilters(msg) {
-		priority += 1000
+	if len(hashtags) > 0 {
+		fmt.Printf("Hashtag filters: %s\n", strings.Join(hashtags, ", "))
 	}
-
-	// ProximityScore (if user has a location filter)
-	priority += proximityScore
-
-	// RecencyScore (TTL remaining as percentage)
-	age := time.Since(msg.Timestamp)
-	ttlDuration := time.Duration(msg.TTL) * 24 * time.Hour
-	if age < ttlDuration {
-		remaining := 1.0 - (float64(age) / float64(ttlDuration))
-		priority += int(remaining * 100)
+	if len(locFilters) > 0 {
+		fmt.Printf("Location filters: %s\n", strings.Join(locFilters, ", "))
 	}
+	fmt.Printf("Receiving on: %s\n", strings.Join(n.Subjects(), ", "))
 
-	// PoWScore
-	priority += powBits * 50
-
-	// HopsScore (negative)
-	priority -= msg.Hops * 10
-
-	return priority
-}
-
-func (s *ChatState) matchesFilters(msg olnjson.Message) bool {
-	if len(s.Filters.Hashtags) == 0 && len(s.Filters.Locations) == 0 {
-		return false
+	if err := n.Start(); err != nil {
+		log.Fatalf("Failed to start node: %v", err)
 	}
+	defer n.Close()
 
-	// Check hashtags
-	for _, filterTag := range s.Filters.Hashtags {
-		for _, msgTag := range msg.Tags {
-			if strings.EqualFold(filterTag, msgTag) {
-				return true
-			}
-		}
-	}
+	// Ask the others what we missed
+	c.fetch(olnjson.Query{Tags: hashtags, Limit: maxCache}, !interactive)
 
-	// Check locations (simple substring match for pluscodes)
-	if len(s.Filters.Locations) > 0 {
-		msgText := msg.Raw
-		for _, locFilter := range s.Filters.Locations {
-			if strings.Contains(msgText, locFilter) {
-				return true
-			}
-		}
+	// Start HTTP feed
+	if httpAddr != "" {
+		go serveHTTP(httpAddr, n.Handler())
+		fmt.Printf("Serving feed on http://%s/oln.json\n", httpAddr)
 	}
 
-	return false
-}
-
-func (s *ChatState) detectPoW(msgText string) int {
-	// Check if message looks like PoW format
-	parts := strings.Split(msgText, ";")
-	if len(parts) < 4 {
-		return 0
-	}
+	if interactive {
+		fmt.Println("Type messages and press Enter to send. Type !help for commands. Ctrl+C to exit.")
+		fmt.Println(strings.Repeat("-", 60))
 
-	// Try to parse as PoW message
-	_, _, _, _, err := pow.ParsePoWMessage(msgText)
-	if err != nil {
-		return 0
+		// Start input handler
+		c.handleInput()
+	} else {
+		fmt.Println("Press Ctrl+C to stop")
+		waitForInterrupt()
 	}
-
-	// Validate PoW
-	powBits := pow.ValidatePoW(msgText)
-	return powBits
 }
 
-func (s *ChatState) evictLowestPriority() {
-	var lowest *MessageEntry
-	var lowestHash string
-
-	for hash, entry := range s.Cache {
-		if lowest == nil || entry.Priority < lowest.Priority {
-			lowest = entry
-			lowestHash = hash
-		}
-	}
-
-	if lowestHash != "" {
-		delete(s.Cache, lowestHash)
+// serveHTTP serves handler on addr until the process exits.
+func serveHTTP(addr string, handler http.Handler) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
-}
-
-func (s *ChatState) rebroadcastLoop() {
-	ticker := time.NewTicker(s.RebroadcastInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-s.stopChan:
-			return
-		case <-ticker.C:
-			s.rebroadcastMessages()
-		}
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("HTTP server failed: %v", err)
 	}
 }
 
-func (s *ChatState) rebroadcastMessages() {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	now := time.Now()
-
-	for hash, entry := range s.Cache {
-		msg := entry.Message
-
-		// Check if message is still valid
-		if msg.Hops >= maxHops {
-			continue
-		}
-
-		age := now.Sub(msg.Timestamp)
-		ttlDuration := time.Duration(msg.TTL) * 24 * time.Hour
-
-		// Don't rebroadcast if expired
-		if age > ttlDuration {
-			continue
-		}
-
-		// Only rebroadcast if >50% TTL remaining
-		if age > ttlDuration/2 {
-			continue
-		}
-
-		// Increment hops and rebroadcast
-		msg.Hops++
-		entry.LastSent = now
-
-		format := olnjson.Format{
-			Server: olnjson.ServerInfo{
-				Link:       "oln.local",
-				Name:       "OLN Node",
-				PubKey:     "",
-				AcceptPush: true,
-			},
-			Messages: map[string]olnjson.Message{
-				hash: msg,
-			},
-			Index: make(map[string][]string),
-			Feeds: []string{},
-			Push:  []string{},
-		}
-
-		jsonData, err := json.Marshal(format)
-		if err != nil {
-			continue
-		}
-
-		s.NC.Publish(natsSubject, jsonData)
+func (c *chat) displayMessage(entry node.MessageEntry) {
+	if entry.Hidden() || c.node.Rejects(entry) {
+		return
 	}
-}
+	msg := entry.Message
 
-func (s *ChatState) cleanupLoop() {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+	fmt.Printf("\n[%s] %s%s\n", msg.Timestamp.Format("2006-01-02 15:04:05"), entry.Hash[:8], c.buildIndicators(&entry))
 
-	for {
-		select {
-		case <-s.stopChan:
-			return
-		case <-ticker.C:
-			s.cleanupExpired()
-		}
+	if tags := describeTags(&entry); tags != "" {
+		fmt.Printf("  Tags: %s\n", tags)
 	}
-}
-
-func (s *ChatState) cleanupExpired() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	now := time.Now()
-
-	for hash, entry := range s.Cache {
-		age := now.Sub(entry.Message.Timestamp)
-		ttlDuration := time.Duration(entry.Message.TTL) * 24 * time.Hour
-
-		if age > ttlDuration {
-			delete(s.Cache, hash)
-		}
+	if from := c.originName(&entry); from != "" {
+		fmt.Printf("  From: %s\n", from)
 	}
+	fmt.Printf("  %s\n", parser.Unpack(entry.Text()))
+	fmt.Print("> ")
 }
 
-func (s *ChatState) handleInput() {
+func (c *chat) handleInput() {
 	scanner := bufio.NewScanner(os.Stdin)
 	fmt.Print("> ")
 
@@ -476,17 +233,26 @@ func (s *ChatState) handleInput() {
 			continue
 		}
 
+		channel := c.node.ActiveChannel()
+
 		if strings.HasPrefix(input, "!") {
-			s.handleCommand(input)
+			c.handleCommand(input)
+		} else if channel != nil {
+			hash, err := c.node.PublishChannel(channel, input)
+			if err != nil {
+				fmt.Printf("Error publishing message: %v\n", err)
+			} else {
+				fmt.Printf("Published to %s (hash: %s)\n", channel.Name, hash[:8])
+			}
 		} else {
-			s.publishMessage(input, 0)
+			c.publishMessage(input, 0)
 		}
 
 		fmt.Print("> ")
 	}
 }
 
-func (s *ChatState) handleCommand(input string) {
+func (c *chat) handleCommand(input string) {
 	parts := strings.Fields(input)
 	if len(parts) == 0 {
 		return
@@ -506,33 +272,128 @@ func (s *ChatState) handleCommand(input string) {
 			return
 		}
 		message := strings.Join(parts[2:], " ")
-		s.publishMessage(message, bits)
+		c.publishMessage(message, bits)
+
+	case "!dm":
+		if len(parts) < 3 {
+			fmt.Println("Usage: !dm <pubkey> <message>")
+			return
+		}
+		hash, err := c.node.PublishDirect(parts[1], strings.Join(parts[2:], " "))
+		if err != nil {
+			fmt.Printf("Error sending private message: %v\n", err)
+			return
+		}
+		fmt.Printf("Sent private message (hash: %s)\n", hash[:8])
+
+	case "!reply":
+		if len(parts) < 3 {
+			fmt.Println("Usage: !reply <hash> <message>")
+			return
+		}
+		c.reply(parts[1], strings.Join(parts[2:], " "))
+
+	case "!thread":
+		if len(parts) < 2 {
+			fmt.Println("Usage: !thread <hash>")
+			return
+		}
+		c.showThread(parts[1])
+
+	case "!trust", "!follow", "!unfollow", "!block", "!unblock", "!forget", "!attest":
+		c.handleContactCommand(cmd, parts[1:])
+
+	case "!contacts":
+		c.showContacts()
+
+	case "!join":
+		if len(parts) < 3 {
+			fmt.Println("Usage: !join <channel> <passphrase>")
+			return
+		}
+		channel, decrypted := c.node.JoinChannel(parts[1], strings.Join(parts[2:], " "))
+		fmt.Printf("Joined channel %s (id: %s), %d cached message(s) decrypted\n", channel.Name, channel.ID, decrypted)
+		fmt.Println("Messages you type now go to this channel. Use !leave to return to public chat.")
+
+	case "!leave":
+		name := ""
+		if len(parts) > 1 {
+			name = parts[1]
+		}
+		left, err := c.node.LeaveChannel(name)
+		if err != nil {
+			fmt.Printf("Cannot leave: %v\n", err)
+			return
+		}
+		fmt.Printf("Left channel %s\n", left)
+
+	case "!at":
+		if len(parts) < 3 {
+			fmt.Println("Usage: !at <lat>,<lng> <message>")
+			return
+		}
+		c.publishAt(parts[1], strings.Join(parts[2:], " "))
 
 	case "!list":
-		s.listMessages(parts[1:])
+		c.listMessages(parts[1:])
 
 	case "!filter":
-		s.handleFilterCommand(parts[1:])
+		c.handleFilterCommand(parts[1:])
 
 	case "!stats":
-		s.showStats()
+		c.showStats()
 
 	case "!show":
 		if len(parts) < 2 {
 			fmt.Println("Usage: !show <hash>")
 			return
 		}
-		s.showMessage(parts[1])
+		c.showMessage(parts[1])
 
 	case "!clear":
-		s.clearCache()
+		fmt.Printf("Cleared %d messages from cache\n", c.node.ClearCache())
 
 	case "!search":
-		s.searchMessages(parts[1:])
+		c.searchMessages(parts[1:])
+
+	case "!fetch":
+		q, err := parseFetchArgs(parts[1:])
+		if err != nil {
+			fmt.Printf("Usage: !fetch [#tag...] [plustag] [since=24h] [from=<pubkey>]: %v\n", err)
+			return
+		}
+		c.fetch(q, false)
+
+	case "!index":
+		if len(parts) < 2 {
+			fmt.Println("Usage: !index <tag|plustag|pubkey|link>")
+			return
+		}
+		c.showIndex(parts[1])
+
+	case "!lookup":
+		if len(parts) < 2 {
+			fmt.Println("Usage: !lookup <tag|plustag|pubkey|link|hash>")
+			return
+		}
+		c.lookup(parts[1])
 
 	case "!help":
 		fmt.Println("Commands:")
 		fmt.Println("  !pow <bits> <message>       - Send message with proof-of-work")
+		fmt.Println("  !dm <pubkey> <message>      - Send an encrypted message to one recipient")
+		fmt.Println("  !reply <hash> <message>     - Reply to a message")
+		fmt.Println("  !thread <hash>              - Show the conversation a message is part of")
+		fmt.Println("  !trust <key> [level] [name] - Trust a sender (level 1-100, default 100), optionally naming them")
+		fmt.Println("  !follow <key> [name]        - Follow a sender: their messages get top priority")
+		fmt.Println("  !block <key> [name]         - Block a sender: their messages are hidden")
+		fmt.Println("  !unfollow, !unblock <key>   - Undo !follow or !block")
+		fmt.Println("  !forget <key>               - Remove a contact")
+		fmt.Println("  !contacts                   - List contacts")
+		fmt.Println("  !attest <key>               - Publish a signed statement of how much you trust a contact")
+		fmt.Println("  !join <name> <passphrase>   - Join an encrypted channel and talk in it")
+		fmt.Println("  !leave [name]               - Leave a channel (default: the active one)")
+		fmt.Println("  !at <lat>,<lng> <message>   - Send message tagged with the plus code of a location")
 		fmt.Println("  !list [N|full]              - List cached messages (top N or full text)")
 		fmt.Println("  !filter add tag <tags>      - Add hashtag filter(s)")
 		fmt.Println("  !filter add location <code> - Add location filter")
@@ -540,10 +401,18 @@ func (s *ChatState) handleCommand(input string) {
 		fmt.Println("  !filter remove location     - Remove location filters")
 		fmt.Println("  !filter clear               - Clear all filters")
 		fmt.Println("  !filter show                - Show active filters")
+		fmt.Println("  !filter mute <tags>         - Hide messages with any of these tags (unmute to undo)")
+		fmt.Println("  !filter block <key|name>    - Hide messages from a sender (unblock to undo)")
+		fmt.Println("  !filter word <regexp>       - Hide messages whose text matches (unword to undo)")
+		fmt.Println("  !filter min-pow <bits>      - Require PoW from senders you don't follow or trust")
+		fmt.Println("  !filter load <file>         - Replace the rules with those in a rules file")
 		fmt.Println("  !search <query>             - Search messages by text/tags/location")
 		fmt.Println("  !search tag <hashtag>       - Search by specific hashtag")
 		fmt.Println("  !search location <code>     - Search by location proximity")
 		fmt.Println("  !search text <keywords>     - Search only in message text")
+		fmt.Println("  !fetch [#tag] [plustag] [since=24h] - Ask other nodes for cached messages")
+		fmt.Println("  !index <key>                - Show what the index holds for a tag, plustag, key or link")
+		fmt.Println("  !lookup <key>               - Find messages for a key, fetching linked feeds")
 		fmt.Println("  !stats                      - Show cache statistics")
 		fmt.Println("  !show <hash>                - Show full message details")
 		fmt.Println("  !clear                      - Clear message cache")
@@ -554,9 +423,9 @@ func (s *ChatState) handleCommand(input string) {
 	}
 }
 
-func (s *ChatState) handleFilterCommand(args []string) {
+func (c *chat) handleFilterCommand(args []string) {
 	if len(args) == 0 {
-		fmt.Println("Usage: !filter <add|remove|clear|show> ...")
+		fmt.Println("Usage: !filter <add|remove|clear|show|mute|unmute|block|unblock|word|unword|min-pow|load> ...")
 		return
 	}
 
@@ -572,9 +441,11 @@ func (s *ChatState) handleFilterCommand(args []string) {
 		value := strings.Join(args[2:], " ")
 
 		if filterType == "tag" {
-			s.addHashtagFilter(value)
+			for _, tag := range c.node.AddHashtagFilters(strings.Split(value, ",")...) {
+				fmt.Printf("Added tag filter: %s\n", tag)
+			}
 		} else if filterType == "location" {
-			s.addLocationFilter(value)
+			c.addLocationFilter(value)
 		} else {
 			fmt.Println("Unknown filter type. Use 'tag' or 'location'")
 		}
@@ -587,449 +458,209 @@ func (s *ChatState) handleFilterCommand(args []string) {
 		filterType := args[1]
 
 		if filterType == "tag" && len(args) >= 3 {
-			s.removeHashtagFilter(args[2])
+			if c.node.RemoveHashtagFilter(args[2]) {
+				fmt.Printf("Removed tag filter: %s\n", args[2])
+			} else {
+				fmt.Printf("Filter not found: %s\n", args[2])
+			}
 		} else if filterType == "location" {
-			s.removeLocationFilter()
+			if count := c.node.ClearLocationFilters(); count > 0 {
+				fmt.Printf("Removed %d location filter(s)\n", count)
+			} else {
+				fmt.Println("No location filters to remove")
+			}
 		} else {
 			fmt.Println("Usage: !filter remove <tag|location> [value]")
 		}
 
 	case "clear":
-		s.clearFilters()
+		c.node.ClearFilters()
+		fmt.Println("All filters cleared")
 
 	case "show":
-		s.showFilters()
+		c.showFilters()
 
-	default:
-		fmt.Println("Unknown filter action. Use: add, remove, clear, or show")
-	}
-}
+	case "mute", "unmute", "block", "unblock", "word", "unword", "min-pow", "load":
+		c.handleRuleCommand(action, args[1:])
 
-func (s *ChatState) addHashtagFilter(tags string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	for _, tag := range strings.Split(tags, ",") {
-		tag = strings.TrimSpace(tag)
-		if tag != "" {
-			// Check if already exists
-			found := false
-			for _, existing := range s.Filters.Hashtags {
-				if existing == tag {
-					found = true
-					break
-				}
-			}
-			if !found {
-				s.Filters.Hashtags = append(s.Filters.Hashtags, tag)
-				fmt.Printf("Added tag filter: %s\n", tag)
-			}
-		}
-	}
-	s.recalculatePriorities()
-}
-
-func (s *ChatState) removeHashtagFilter(tag string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	for i, t := range s.Filters.Hashtags {
-		if t == tag {
-			s.Filters.Hashtags = append(s.Filters.Hashtags[:i], s.Filters.Hashtags[i+1:]...)
-			fmt.Printf("Removed tag filter: %s\n", tag)
-			s.recalculatePriorities()
-			return
-		}
+	default:
+		fmt.Println("Unknown filter action. Use: add, remove, clear, show, mute, unmute, block, unblock, word, unword, min-pow or load")
 	}
-	fmt.Printf("Filter not found: %s\n", tag)
 }
 
-func (s *ChatState) addLocationFilter(locationCode string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
+func (c *chat) addLocationFilter(locationCode string) {
 	locationCode = strings.TrimSpace(locationCode)
 	// Accept any location code format (will validate in proximity calculation)
 	if !location.ValidatePluscode(locationCode) {
 		fmt.Printf("Warning: '%s' may not be a valid pluscode\n", locationCode)
 	}
 
-	// Check if already exists
-	for _, existing := range s.Filters.Locations {
-		if existing == locationCode {
-			fmt.Printf("Location filter already exists: %s\n", locationCode)
-			return
-		}
-	}
-
-	s.Filters.Locations = append(s.Filters.Locations, locationCode)
-	fmt.Printf("Added location filter: %s\n", locationCode)
-	s.recalculatePriorities()
-}
-
-func (s *ChatState) removeLocationFilter() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if len(s.Filters.Locations) == 0 {
-		fmt.Println("No location filters to remove")
+	if !c.node.AddLocationFilter(locationCode) {
+		fmt.Printf("Location filter already exists: %s\n", locationCode)
 		return
 	}
-
-	fmt.Printf("Removed %d location filter(s)\n", len(s.Filters.Locations))
-	s.Filters.Locations = []string{}
-	s.recalculatePriorities()
-}
-
-func (s *ChatState) clearFilters() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.Filters.Hashtags = []string{}
-	s.Filters.Locations = []string{}
-	fmt.Println("All filters cleared")
-	s.recalculatePriorities()
+	fmt.Printf("Added location filter: %s\n", locationCode)
 }
 
-func (s *ChatState) showFilters() {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (c *chat) showFilters() {
+	filters := c.node.Filters()
+	rules := c.node.Rules()
 
-	if len(s.Filters.Hashtags) == 0 && len(s.Filters.Locations) == 0 {
+	if filters.Empty() && rules.Empty() {
 		fmt.Println("No active filters")
 		return
 	}
 
-	if len(s.Filters.Hashtags) > 0 {
-		fmt.Printf("Hashtag filters: %s\n", strings.Join(s.Filters.Hashtags, ", "))
+	if len(filters.Hashtags) > 0 {
+		fmt.Printf("Hashtag filters: %s\n", strings.Join(filters.Hashtags, ", "))
 	}
-	if len(s.Filters.Locations) > 0 {
-		fmt.Printf("Location filters: %s\n", strings.Join(s.Filters.Locations, ", "))
+	if len(filters.Locations) > 0 {
+		fmt.Printf("Location filters: %s\n", strings.Join(filters.Locations, ", "))
 	}
-}
-
-func (s *ChatState) recalculatePriorities() {
-	for _, entry := range s.Cache {
-		// Recalculate proximity if location filters changed
-		proximityScore := 0
-		if len(s.Filters.Locations) > 0 && len(entry.Plustags) > 0 {
-			for _, msgLoc := range entry.Plustags {
-				for _, userLoc := range s.Filters.Locations {
-					score := location.CalculateProximity(msgLoc, userLoc)
-					if score > proximityScore {
-						proximityScore = score
-					}
-				}
-			}
-		}
-		entry.ProximityScore = proximityScore
-
-		// Recalculate priority
-		entry.Priority = s.calculatePriority(entry.Message, entry.PoWBits, proximityScore)
+	if len(rules.MutedTags) > 0 {
+		fmt.Printf("Muted tags: %s\n", strings.Join(rules.MutedTags, ", "))
+	}
+	for _, origin := range rules.BlockedOrigins {
+		fmt.Printf("Blocked: %s\n", c.contactName(origin))
+	}
+	for _, pattern := range rules.Words {
+		fmt.Printf("Word filter: %s\n", pattern)
+	}
+	if rules.UnknownMinPoW > 0 {
+		fmt.Printf("Unknown senders need PoW: %d bits\n", rules.UnknownMinPoW)
 	}
 }
 
-func (s *ChatState) showStats() {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (c *chat) showStats() {
+	stats := c.node.Stats()
+	filters := c.node.Filters()
 
-	fmt.Printf("Cache: %d/%d messages\n", len(s.Cache), s.MaxCacheSize)
+	fmt.Printf("Cache: %d/%d messages\n", stats.Cached, stats.MaxCache)
 
-	if len(s.Filters.Hashtags) > 0 || len(s.Filters.Locations) > 0 {
+	if !filters.Empty() {
 		fmt.Print("Filters: ")
-		if len(s.Filters.Hashtags) > 0 {
-			fmt.Print(strings.Join(s.Filters.Hashtags, ", "))
+		if len(filters.Hashtags) > 0 {
+			fmt.Print(strings.Join(filters.Hashtags, ", "))
 		}
-		if len(s.Filters.Locations) > 0 {
-			if len(s.Filters.Hashtags) > 0 {
+		if len(filters.Locations) > 0 {
+			if len(filters.Hashtags) > 0 {
 				fmt.Print(" | ")
 			}
-			fmt.Print(strings.Join(s.Filters.Locations, ", "))
+			fmt.Print(strings.Join(filters.Locations, ", "))
 		}
 		fmt.Println()
 	} else {
 		fmt.Println("Filters: none")
 	}
 
-	if len(s.Cache) > 0 {
-		var totalAge time.Duration
-		var minPriority, maxPriority int
-		first := true
-
-		for _, entry := range s.Cache {
-			totalAge += time.Since(entry.FirstSeen)
-			if first {
-				minPriority = entry.Priority
-				maxPriority = entry.Priority
-				first = false
-			} else {
-				if entry.Priority < minPriority {
-					minPriority = entry.Priority
-				}
-				if entry.Priority > maxPriority {
-					maxPriority = entry.Priority
-				}
-			}
-		}
-
-		avgAge := totalAge / time.Duration(len(s.Cache))
-		fmt.Printf("Average age: %s\n", avgAge.Round(time.Second))
-		fmt.Printf("Priority range: %d-%d\n", minPriority, maxPriority)
+	if stats.Cached > 0 {
+		fmt.Printf("Average age: %s\n", stats.AverageAge.Round(time.Second))
+		fmt.Printf("Priority range: %d-%d\n", stats.MinPriority, stats.MaxPriority)
 	}
 }
 
-func (s *ChatState) showMessage(hashPrefix string) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (c *chat) showMessage(hashPrefix string) {
+	entry, ok := c.node.FindEntry(hashPrefix)
+	if !ok {
+		fmt.Printf("Message not found: %s\n", hashPrefix)
+		return
+	}
 
-	// Find message by hash prefix
-	for hash, entry := range s.Cache {
-		if strings.HasPrefix(hash, hashPrefix) {
-			msg := entry.Message
-			indicator := s.buildIndicators(entry)
+	msg := entry.Message
+	indicator := c.buildIndicators(&entry)
 
-			fmt.Printf("\n[%s] %s%s\n", msg.Timestamp.Format("2006-01-02 15:04:05"), hash, indicator)
-			fmt.Printf("Priority: %d\n", entry.Priority)
-			fmt.Printf("Age: %s\n", time.Since(msg.Timestamp).Round(time.Second))
+	fmt.Printf("\n[%s] %s%s\n", msg.Timestamp.Format("2006-01-02 15:04:05"), entry.Hash, indicator)
+	fmt.Printf("Priority: %d\n", entry.Priority)
+	fmt.Printf("Age: %s\n", time.Since(msg.Timestamp).Round(time.Second))
 
-			if len(msg.Tags) > 0 {
-				fmt.Printf("Tags: %s\n", strings.Join(msg.Tags, ", "))
-			}
-			if msg.Origin.Display != "" {
-				fmt.Printf("From: %s\n", msg.Origin.Display)
-			}
-			fmt.Printf("\n%s\n", msg.Raw)
-			return
+	if tags := describeTags(&entry); tags != "" {
+		fmt.Printf("Tags: %s\n", tags)
+	}
+	if from := c.originName(&entry); from != "" {
+		fmt.Printf("From: %s\n", from)
+	}
+	if msg.Origin.PubKey != "" {
+		fmt.Printf("Key: %s (%s)\n", msg.Origin.PubKey, entry.SigStatus)
+	}
+	for _, plustag := range entry.Plustags {
+		if area, err := location.Decode(plustag); err == nil {
+			lat, lng := area.Center()
+			fmt.Printf("Location: %s = %.6f,%.6f (%.6f,%.6f to %.6f,%.6f)\n",
+				plustag, lat, lng, area.LatLo, area.LngLo, area.LatHi, area.LngHi)
 		}
 	}
-
-	fmt.Printf("Message not found: %s\n", hashPrefix)
-}
-
-func (s *ChatState) clearCache() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	count := len(s.Cache)
-	s.Cache = make(map[string]*MessageEntry)
-	fmt.Printf("Cleared %d messages from cache\n", count)
+	fmt.Printf("\n%s\n", parser.Unpack(entry.Text()))
 }
 
-func (s *ChatState) searchMessages(args []string) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
+func (c *chat) searchMessages(args []string) {
 	if len(args) == 0 {
 		fmt.Println("Usage: !search <query> | !search tag <tag> | !search location <code> | !search text <keywords>")
 		return
 	}
 
-	var matches []struct {
-		hash  string
-		entry *MessageEntry
-	}
-
-	mode := "default"
-	query := strings.Join(args, " ")
+	q := node.SearchQuery{Mode: node.SearchAll, Query: strings.Join(args, " ")}
 
 	// Detect search mode
 	if len(args) >= 2 {
 		if args[0] == "tag" {
-			mode = "tag"
-			query = strings.Join(args[1:], " ")
+			q = node.SearchQuery{Mode: node.SearchTag, Query: strings.Join(args[1:], " ")}
 		} else if args[0] == "location" {
-			mode = "location"
-			query = strings.Join(args[1:], " ")
+			q = node.SearchQuery{Mode: node.SearchLocation, Query: strings.Join(args[1:], " ")}
 		} else if args[0] == "text" {
-			mode = "text"
-			query = strings.Join(args[1:], " ")
-		}
-	}
-
-	queryLower := strings.ToLower(query)
-
-	// Search through cache
-	for hash, entry := range s.Cache {
-		match := false
-
-		switch mode {
-		case "tag":
-			// Search for exact tag match
-			for _, tag := range entry.Message.Tags {
-				if strings.EqualFold(tag, query) {
-					match = true
-					break
-				}
-			}
-
-		case "location":
-			// Use proximity scoring for location matching
-			for _, plustag := range entry.Plustags {
-				if location.CalculateProximity(plustag, query) > 0 {
-					match = true
-					break
-				}
-			}
-
-		case "text":
-			// Search only in message text
-			if strings.Contains(strings.ToLower(entry.Message.Raw), queryLower) {
-				match = true
-			}
-
-		default:
-			// Search in message text
-			if strings.Contains(strings.ToLower(entry.Message.Raw), queryLower) {
-				match = true
-			}
-			// Search in tags
-			if !match {
-				for _, tag := range entry.Message.Tags {
-					if strings.Contains(strings.ToLower(tag), queryLower) {
-						match = true
-						break
-					}
-				}
-			}
-			// Search in plustags
-			if !match {
-				for _, plustag := range entry.Plustags {
-					if strings.Contains(strings.ToLower(plustag), queryLower) {
-						match = true
-						break
-					}
-				}
-			}
-		}
-
-		if match {
-			matches = append(matches, struct {
-				hash  string
-				entry *MessageEntry
-			}{hash, entry})
+			q = node.SearchQuery{Mode: node.SearchText, Query: strings.Join(args[1:], " ")}
 		}
 	}
 
+	matches := c.node.Search(q)
 	if len(matches) == 0 {
-		fmt.Printf("No messages found for: %s\n", query)
+		fmt.Printf("No messages found for: %s\n", q.Query)
 		return
 	}
 
-	// Sort by priority (most relevant first)
-	sort.Slice(matches, func(i, j int) bool {
-		return matches[i].entry.Priority > matches[j].entry.Priority
-	})
-
-	fmt.Printf("Found %d message(s) for: %s\n", len(matches), query)
-	for i, m := range matches {
-		indicator := s.buildIndicators(m.entry)
-		age := time.Since(m.entry.Message.Timestamp)
-
-		fmt.Printf("%d. [%s] priority: %d, age: %s%s\n",
-			i+1, m.hash[:8], m.entry.Priority, age.Round(time.Second), indicator)
-
-		if len(m.entry.Message.Tags) > 0 {
-			fmt.Printf("   Tags: %s\n", strings.Join(m.entry.Message.Tags, ", "))
-		}
-
-		text := m.entry.Message.Raw
-		if len(text) > 70 {
-			text = text[:70] + "..."
-		}
-		fmt.Printf("   \"%s\"\n", text)
-	}
+	fmt.Printf("Found %d message(s) for: %s\n", len(matches), q.Query)
+	c.printEntries(matches, false)
 }
 
-func (s *ChatState) publishMessage(messageText string, powBits int) {
-	var finalMessage string
-	var msgHash string
-
+func (c *chat) publishMessage(messageText string, powBits int) {
 	if powBits > 0 {
 		fmt.Printf("Computing proof-of-work (%d bits)...\n", powBits)
-		finalMessage = pow.CreatePoWMessage(powBits, "oln", messageText)
-		msgHash = generateHash(finalMessage)
-	} else if s.AutoPoWBits > 0 {
-		fmt.Printf("Applying auto PoW (%d bits)...\n", s.AutoPoWBits)
-		finalMessage = pow.CreatePoWMessage(s.AutoPoWBits, "oln", messageText)
-		msgHash = generateHash(finalMessage)
-	} else {
-		finalMessage = messageText
-		msgHash = generateHash(finalMessage)
-	}
-
-	// Create message
-	tags := extractHashtags(finalMessage)
-
-	// Extract plustags and geo hashtags
-	plustags := location.AllPlustags(finalMessage)
-	allTags := make([]string, len(tags))
-	copy(allTags, tags)
-	allTags = append(allTags, plustags...)
-
-	msg := olnjson.Message{
-		Raw:       finalMessage,
-		Timestamp: time.Now(),
-		TTL:       ttlDays,
-		Hops:      0,
-		Tags:      allTags,
-		Sig:       "",
-		Origin: olnjson.Origin{
-			Display:    "anonymous",
-			PubKey:     "",
-			ServerName: "",
-		},
+	} else if c.node.AutoPoWBits > 0 {
+		fmt.Printf("Applying auto PoW (%d bits)...\n", c.node.AutoPoWBits)
 	}
 
-	// Create format
-	format := olnjson.Format{
-		Server: olnjson.ServerInfo{
-			Link:       "oln.local",
-			Name:       "OLN Node",
-			PubKey:     "",
-			AcceptPush: true,
-		},
-		Messages: map[string]olnjson.Message{
-			msgHash: msg,
-		},
-		Index: make(map[string][]string),
-		Feeds: []string{},
-		Push:  []string{},
+	msgHash, err := c.node.Publish(messageText, powBits)
+	if err != nil {
+		fmt.Printf("Error publishing message: %v\n", err)
+		return
 	}
 
-	// Add regular tags to index
-	for _, tag := range tags {
-		format.Index[tag] = append(format.Index[tag], msgHash)
-	}
+	fmt.Printf("Published (hash: %s)\n", msgHash[:8])
+}
 
-	// Add plustags and their hierarchy to index
-	for _, plustag := range plustags {
-		parents := location.GetParentPlustags(plustag)
-		for _, parent := range parents {
-			format.Index[parent] = append(format.Index[parent], msgHash)
-		}
+// publishAt publishes text with the plus code of the given coordinates appended.
+func (c *chat) publishAt(coords, text string) {
+	latStr, lngStr, ok := strings.Cut(coords, ",")
+	if !ok {
+		fmt.Println("Coordinates must be given as <lat>,<lng>")
+		return
 	}
-
-	// Marshal and publish
-	jsonData, err := json.Marshal(format)
+	lat, err := strconv.ParseFloat(latStr, 64)
 	if err != nil {
-		fmt.Printf("Error marshaling message: %v\n", err)
+		fmt.Printf("Invalid latitude: %s\n", latStr)
 		return
 	}
-
-	err = s.NC.Publish(natsSubject, jsonData)
+	lng, err := strconv.ParseFloat(lngStr, 64)
 	if err != nil {
-		fmt.Printf("Error publishing message: %v\n", err)
+		fmt.Printf("Invalid longitude: %s\n", lngStr)
 		return
 	}
 
-	fmt.Printf("Published (hash: %s)\n", msgHash[:8])
+	c.publishMessage(text+" "+location.Encode(lat, lng, 10), 0)
 }
 
-func (s *ChatState) listMessages(args []string) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	if len(s.Cache) == 0 {
+func (c *chat) listMessages(args []string) {
+	total := c.node.CacheSize()
+	if total == 0 {
 		fmt.Println("No messages cached")
 		return
 	}
@@ -1046,40 +677,33 @@ func (s *ChatState) listMessages(args []string) {
 		}
 	}
 
-	// Sort by priority
-	type sortEntry struct {
-		hash  string
-		entry *MessageEntry
-	}
-
-	var entries []sortEntry
-	for hash, entry := range s.Cache {
-		entries = append(entries, sortEntry{hash, entry})
-	}
-
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].entry.Priority > entries[j].entry.Priority
-	})
-
+	entries := c.node.Messages()
 	if limit > 0 && limit < len(entries) {
 		entries = entries[:limit]
 	}
 
-	fmt.Printf("Cached messages (%d/%d):\n", len(entries), len(s.Cache))
-	for i, e := range entries {
-		indicator := s.buildIndicators(e.entry)
+	fmt.Printf("Cached messages (%d/%d):\n", len(entries), total)
+	c.printEntries(entries, fullText)
+}
+
+// printEntries prints a numbered list of entries, with their text cut
+// short unless fullText is set.
+func (c *chat) printEntries(entries []node.MessageEntry, fullText bool) {
+	for i := range entries {
+		entry := &entries[i]
+		indicator := c.buildIndicators(entry)
 
-		age := time.Since(e.entry.Message.Timestamp)
+		age := time.Since(entry.Message.Timestamp)
 		fmt.Printf("%d. [%s] priority: %d, age: %s%s\n",
-			i+1, e.hash[:8], e.entry.Priority, age.Round(time.Second), indicator)
+			i+1, entry.Hash[:8], entry.Priority, age.Round(time.Second), indicator)
 
 		// Show tags
-		if len(e.entry.Message.Tags) > 0 {
-			fmt.Printf("   Tags: %s\n", strings.Join(e.entry.Message.Tags, ", "))
+		if tags := describeTags(entry); tags != "" {
+			fmt.Printf("   Tags: %s\n", tags)
 		}
 
 		// Show message text
-		text := e.entry.Message.Raw
+		text := parser.Unpack(entry.Text())
 		if !fullText && len(text) > 70 {
 			text = text[:70] + "..."
 		}
@@ -1087,10 +711,29 @@ func (s *ChatState) listMessages(args []string) {
 	}
 }
 
-func (s *ChatState) buildIndicators(entry *MessageEntry) string {
+// describeTags lists the tags and plustags of an entry, with the alttext
+// the message gives for them, like "Amsterdam Centraal (9F469VXG+)".
+func describeTags(entry *node.MessageEntry) string {
+	alts := parser.Alttexts(entry.Text())
+	seen := make(map[string]bool)
+	var tags []string
+	for _, tag := range append(append([]string(nil), entry.Message.Tags...), entry.Plustags...) {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if alt, ok := alts[tag]; ok {
+			tag = fmt.Sprintf("%s (%s)", alt, tag)
+		}
+		tags = append(tags, tag)
+	}
+	return strings.Join(tags, ", ")
+}
+
+func (c *chat) buildIndicators(entry *node.MessageEntry) string {
 	indicator := ""
 
-	if s.matchesFilters(entry.Message) {
+	if c.node.MatchesFilters(entry) {
 		indicator = " [★]"
 	}
 
@@ -1108,5 +751,26 @@ func (s *ChatState) buildIndicators(entry *MessageEntry) string {
 		indicator += fmt.Sprintf(" [PoW:%d]", entry.PoWBits)
 	}
 
+	indicator += sigIndicator(entry.SigStatus)
+	indicator += c.trustIndicator(entry)
+
+	if entry.Private {
+		indicator += " [🔒 private]"
+	}
+	if entry.Channel != "" {
+		indicator += fmt.Sprintf(" [🔒 %s]", entry.Channel)
+	}
+
 	return indicator
 }
+
+func sigIndicator(status signing.Status) string {
+	switch status {
+	case signing.Valid:
+		return " [✓]"
+	case signing.Forged:
+		return " [⚠ forged]"
+	default:
+		return " [unsigned]"
+	}
+}
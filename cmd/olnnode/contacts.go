@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/node"
+	"github.com/lapingvino/eolnpoc/signing"
+	"github.com/lapingvino/eolnpoc/trust"
+)
+
+func defaultContactsPath() string {
+	path, err := trust.DefaultPath()
+	if err != nil {
+		return "contacts.json"
+	}
+	return path
+}
+
+// handleContactCommand handles !trust, !follow, !unfollow, !block,
+// !unblock, !forget and !attest.
+func (c *chat) handleContactCommand(cmd string, args []string) {
+	if len(args) == 0 {
+		fmt.Printf("Usage: %s <pubkey|petname> ...\n", cmd)
+		return
+	}
+	pubKey, err := c.node.Contacts.Resolve(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	contact, known := c.node.Contacts.Get(pubKey)
+	contact.PubKey = pubKey
+	args = args[1:]
+
+	switch cmd {
+	case "!trust":
+		contact.Trust = trust.MaxLevel
+		if len(args) > 0 {
+			if level, err := strconv.Atoi(args[0]); err == nil {
+				contact.Trust = level
+				args = args[1:]
+			}
+		}
+		contact.Blocked = false
+	case "!follow":
+		contact.Follow = true
+		contact.Blocked = false
+	case "!unfollow":
+		contact.Follow = false
+	case "!block":
+		contact.Blocked = true
+		contact.Follow = false
+		contact.Trust = 0
+	case "!unblock":
+		contact.Blocked = false
+	case "!forget":
+		if removed, err := c.node.RemoveContact(pubKey); err != nil {
+			fmt.Printf("Error saving contacts: %v\n", err)
+		} else if removed {
+			fmt.Printf("Forgot %s\n", c.contactName(pubKey))
+		} else {
+			fmt.Printf("Not a contact: %s\n", pubKey)
+		}
+		return
+	case "!attest":
+		c.attest(pubKey, contact)
+		return
+	}
+
+	if len(args) > 0 {
+		contact.Petname = strings.Join(args, " ")
+	}
+	if err := c.node.SetContact(contact); err != nil {
+		fmt.Printf("Error saving contact: %v\n", err)
+		return
+	}
+
+	verb := "Updated"
+	if !known {
+		verb = "Added"
+	}
+	fmt.Printf("%s %s: %s\n", verb, c.contactName(pubKey), describeContact(contact))
+}
+
+// attest publishes how much we trust a contact.
+func (c *chat) attest(pubKey string, contact trust.Contact) {
+	level := contact.Trust
+	if contact.Blocked {
+		level = 0
+	}
+	hash, err := c.node.PublishAttestation(pubKey, level)
+	if err != nil {
+		fmt.Printf("Error publishing attestation: %v\n", err)
+		return
+	}
+	fmt.Printf("Attested trust %d in %s (hash: %s)\n", level, c.contactName(pubKey), hash[:8])
+}
+
+func (c *chat) showContacts() {
+	contacts := c.node.Contacts.Contacts()
+	if len(contacts) == 0 {
+		fmt.Println("No contacts. Use !trust, !follow or !block <pubkey> [petname].")
+		return
+	}
+
+	fmt.Printf("Contacts (%d):\n", len(contacts))
+	for _, contact := range contacts {
+		name := contact.Petname
+		if name == "" {
+			name = "-"
+		}
+		fmt.Printf("  %-16s %s  %s\n", name, contact.PubKey, describeContact(contact))
+	}
+}
+
+func describeContact(contact trust.Contact) string {
+	var parts []string
+	if contact.Blocked {
+		parts = append(parts, "blocked")
+	}
+	if contact.Follow {
+		parts = append(parts, "following")
+	}
+	if contact.Trust > 0 {
+		parts = append(parts, fmt.Sprintf("trust %d", contact.Trust))
+	}
+	if len(parts) == 0 {
+		return "no trust"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// contactName returns the petname of pubKey, or pubKey itself.
+func (c *chat) contactName(pubKey string) string {
+	if contact, ok := c.node.Contacts.Get(pubKey); ok && contact.Petname != "" {
+		return contact.Petname
+	}
+	return pubKey
+}
+
+// originName returns who a message is from: its display name, with our
+// petname for the sender if the signature proves it is them.
+func (c *chat) originName(entry *node.MessageEntry) string {
+	origin := entry.Message.Origin
+	if entry.SigStatus != signing.Valid {
+		return origin.Display
+	}
+	contact, ok := c.node.Contacts.Get(origin.PubKey)
+	if !ok || contact.Petname == "" || contact.Petname == origin.Display {
+		return origin.Display
+	}
+	if origin.Display == "" {
+		return contact.Petname
+	}
+	return fmt.Sprintf("%s (%s)", origin.Display, contact.Petname)
+}
+
+// trustIndicator marks messages of followed, trusted and blocked senders.
+func (c *chat) trustIndicator(entry *node.MessageEntry) string {
+	if entry.SigStatus != signing.Valid {
+		return ""
+	}
+	pubKey := entry.Message.Origin.PubKey
+
+	indicator := ""
+	if c.node.Contacts.Follows(pubKey) {
+		indicator = " [following]"
+	}
+	switch score := c.node.Contacts.Score(pubKey); {
+	case score < 0:
+		indicator += " [blocked]"
+	case score > 0:
+		indicator += fmt.Sprintf(" [trust:%d]", score)
+	}
+	return indicator
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/feed"
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+func crawlCommand(args []string) {
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+	depth := fs.Int("depth", 2, "How many feed links to follow from the start feeds")
+	maxFeeds := fs.Int("max-feeds", 50, "Maximum number of feeds to fetch")
+	delay := fs.Duration("delay", time.Second, "Minimum time between requests")
+	sigPolicy := fs.String("sig-policy", "flag", "Signature policy: flag, drop-forged or drop-unsigned")
+	fs.Parse(args)
+	policy := parseSigPolicy(*sigPolicy)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: crawl requires at least one feed URL\n")
+		os.Exit(1)
+	}
+
+	// Merge messages from all feeds, showing each one once
+	seen := make(map[string]bool)
+	feeds := 0
+
+	crawler := newCrawler(*depth, *maxFeeds, *delay, func(url string, format *olnjson.Format) {
+		feeds++
+		fmt.Printf("\n== %s (%s, %d messages, %d feeds)\n", url, format.Server.Name, len(format.Messages), len(format.Feeds))
+
+		fresh := olnjson.Format{Messages: make(map[string]olnjson.Message)}
+		for hash, msg := range format.Messages {
+			if seen[hash] {
+				continue
+			}
+			// A forged copy must not hide the genuine one
+			if err := multihash.Verify(hash, msg); err != nil {
+				log.Printf("Rejected message %s: %v", hash, err)
+				continue
+			}
+			seen[hash] = true
+			fresh.Messages[hash] = msg
+		}
+		displayMessage(&fresh, policy)
+	})
+
+	if err := crawler.Crawl(context.Background(), fs.Args()); err != nil {
+		log.Fatalf("Crawl failed: %v", err)
+	}
+
+	fmt.Println(strings.Repeat("-", 60))
+	fmt.Printf("Crawled %d feed(s), %d unique message(s)\n", feeds, len(seen))
+}
+
+func newCrawler(depth, maxFeeds int, delay time.Duration, visit func(string, *olnjson.Format)) *feed.Crawler {
+	crawler := feed.NewCrawler(visit)
+	crawler.MaxDepth = depth
+	crawler.MaxFeeds = maxFeeds
+	crawler.Delay = delay
+	crawler.OnError = func(url string, err error) {
+		log.Printf("Skipping feed %s: %v", url, err)
+	}
+	return crawler
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/hub"
+)
+
+// hubCommand runs an embedded NATS hub. Without further arguments it
+// serves until interrupted; otherwise the rest of the arguments are a
+// command that runs against the hub, like `hub chat --tag=#OLN`.
+func hubCommand(args []string) {
+	fs := flag.NewFlagSet("hub", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: olnnode hub [options] [listen|publish|chat|serve|query [args...]]\n")
+		fs.PrintDefaults()
+	}
+	listen := fs.String("listen", hub.DefaultAddr, "Address to accept NATS clients on")
+	routes := fs.String("route", "", "Comma-separated NATS URLs of other hubs to link with")
+	name := fs.String("name", "", "Hub name announced to clients and other hubs")
+	routeToken := fs.String("route-token", "", "Secret shared by linked hubs, required with --route; route claims without it are refused")
+	tlsCert := fs.String("tls-cert", "", "Certificate file to require TLS of clients with")
+	tlsKey := fs.String("tls-key", "", "Key file of the --tls-cert certificate")
+	routeCA := fs.String("route-ca", "", "CA certificate file to verify TLS routes with instead of the system roots")
+	fs.Parse(args)
+
+	opts := hub.Options{
+		Addr:       *listen,
+		Name:       *name,
+		Routes:     splitList(*routes),
+		RouteToken: *routeToken,
+	}
+	if *tlsCert != "" || *tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		opts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	if *routeCA != "" {
+		pem, err := os.ReadFile(*routeCA)
+		if err != nil {
+			log.Fatalf("Failed to read route CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Fatalf("No certificates in %s", *routeCA)
+		}
+		opts.RouteTLS = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	srv, err := hub.Start(opts)
+	if err != nil {
+		log.Fatalf("Failed to start hub: %v", err)
+	}
+	defer srv.Close()
+
+	fmt.Printf("OLN hub listening on %s (clients: %s)\n", srv.Addr(), srv.ClientURL())
+	if r := splitList(*routes); len(r) > 0 {
+		fmt.Printf("Routes: %s\n", strings.Join(r, ", "))
+	}
+
+	if fs.NArg() == 0 {
+		fmt.Println("Press Ctrl+C to stop")
+		waitForInterrupt()
+		return
+	}
+	runCommand(srv.ClientURL(), fs.Arg(0), fs.Args()[1:])
+}
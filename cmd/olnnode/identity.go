@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/keystore"
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/signing"
+	"golang.org/x/term"
+)
+
+// passphraseEnv can hold the passphrase of identities, for scripts.
+const passphraseEnv = "OLN_PASSPHRASE"
+
+func identityUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: olnnode identity <command> [options]\n")
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  new [options] <name>      - Create a new identity\n")
+	fmt.Fprintf(os.Stderr, "  list                      - List identities\n")
+	fmt.Fprintf(os.Stderr, "  export <name> [file]      - Write an identity, key still encrypted, to file or stdout\n")
+	fmt.Fprintf(os.Stderr, "  import [options] <file>   - Add an exported identity or a plain key file\n")
+	fmt.Fprintf(os.Stderr, "\nOptions: --keystore=<dir> --display=<name> --server-name=<name> (new, import) --name=<name> (import)\n")
+	fmt.Fprintf(os.Stderr, "The passphrase is asked for, or read from $%s.\n", passphraseEnv)
+}
+
+func identityCommand(args []string) {
+	if len(args) == 0 {
+		identityUsage()
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("identity "+args[0], flag.ExitOnError)
+	storeDir := fs.String("keystore", "", "Identity directory (default: "+defaultKeystore()+")")
+	display := fs.String("display", "", "Display name messages are sent with")
+	serverName := fs.String("server-name", "", "Server name messages are sent with")
+	name := fs.String("name", "", "Name to import the identity as")
+	fs.Parse(args[1:])
+
+	store, err := keystore.Open(*storeDir)
+	if err != nil {
+		log.Fatalf("Failed to open keystore: %v", err)
+	}
+
+	switch args[0] {
+	case "new":
+		if fs.NArg() != 1 {
+			identityUsage()
+			os.Exit(1)
+		}
+		passphrase := readPassphrase("New passphrase: ", true)
+		id, err := store.Create(fs.Arg(0), *display, *serverName, passphrase)
+		if err != nil {
+			log.Fatalf("Failed to create identity: %v", err)
+		}
+		fmt.Printf("Created identity %s: %s\n", id.Name, id.PubKey)
+
+	case "list":
+		ids, err := store.List()
+		if err != nil {
+			log.Fatalf("Failed to list identities: %v", err)
+		}
+		if len(ids) == 0 {
+			fmt.Printf("No identities in %s\n", store.Dir)
+			return
+		}
+		for _, id := range ids {
+			fmt.Printf("%-16s %s", id.Name, id.PubKey)
+			if id.Display != "" {
+				fmt.Printf("  %s", id.Display)
+			}
+			if id.ServerName != "" {
+				fmt.Printf(" @ %s", id.ServerName)
+			}
+			fmt.Println()
+		}
+
+	case "export":
+		if fs.NArg() < 1 || fs.NArg() > 2 {
+			identityUsage()
+			os.Exit(1)
+		}
+		data, err := store.Export(fs.Arg(0))
+		if err != nil {
+			log.Fatalf("Failed to export identity: %v", err)
+		}
+		if fs.NArg() == 1 {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(fs.Arg(1), data, 0600); err != nil {
+			log.Fatalf("Failed to write %s: %v", fs.Arg(1), err)
+		}
+		fmt.Printf("Exported identity %s to %s\n", fs.Arg(0), fs.Arg(1))
+
+	case "import":
+		if fs.NArg() != 1 {
+			identityUsage()
+			os.Exit(1)
+		}
+		id, err := importIdentity(store, fs.Arg(0), *name, *display, *serverName)
+		if err != nil {
+			log.Fatalf("Failed to import identity: %v", err)
+		}
+		fmt.Printf("Imported identity %s: %s\n", id.Name, id.PubKey)
+
+	default:
+		identityUsage()
+		os.Exit(1)
+	}
+}
+
+// importIdentity adds the identity in path to the store. Exported
+// identities are stored as they are; plain key files, like the one --key
+// uses, are encrypted with a new passphrase. The name defaults to the
+// exported name or the file name.
+func importIdentity(store *keystore.Store, path, name, display, serverName string) (*keystore.Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fileName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	if id, err := keystore.Parse(data); err == nil {
+		switch {
+		case name != "":
+			id.Name = name
+		case id.Name == "":
+			id.Name = fileName
+		}
+		if display != "" {
+			id.Display = display
+		}
+		if serverName != "" {
+			id.ServerName = serverName
+		}
+		return id, store.Save(id)
+	}
+
+	key, err := signing.LoadKey(path)
+	if err != nil {
+		return nil, errors.New("not an identity or key file")
+	}
+	if name == "" {
+		name = fileName
+	}
+	return store.Add(name, display, serverName, key, readPassphrase("New passphrase: ", true))
+}
+
+// chooseIdentity returns the key and origin to send messages with: the
+// named identity from the keystore, or else the plain key file at keyPath
+// with an anonymous origin.
+func chooseIdentity(keyPath, storeDir, name string) (ed25519.PrivateKey, olnjson.Origin) {
+	if name == "" {
+		return loadIdentity(keyPath), olnjson.Origin{}
+	}
+
+	store, err := keystore.Open(storeDir)
+	if err != nil {
+		log.Fatalf("Failed to open keystore: %v", err)
+	}
+	id, err := store.Get(name)
+	if err != nil {
+		log.Fatalf("Failed to load identity: %v", err)
+	}
+	key, err := id.Unlock(readPassphrase(fmt.Sprintf("Passphrase for %s: ", name), false))
+	if err != nil {
+		log.Fatalf("Failed to unlock identity %s: %v", name, err)
+	}
+	return key, id.Origin()
+}
+
+func defaultKeystore() string {
+	dir, err := keystore.DefaultDir()
+	if err != nil {
+		return "identities"
+	}
+	return dir
+}
+
+// readPassphrase returns the passphrase from the environment or asks for
+// it on the terminal, twice if confirm is set. Without a terminal it reads
+// a line from stdin.
+func readPassphrase(prompt string, confirm bool) string {
+	if passphrase, ok := os.LookupEnv(passphraseEnv); ok {
+		return passphrase
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return readLine(os.Stdin)
+	}
+
+	for {
+		fmt.Fprint(os.Stderr, prompt)
+		passphrase, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			log.Fatalf("Failed to read passphrase: %v", err)
+		}
+		if !confirm {
+			return string(passphrase)
+		}
+		if len(passphrase) == 0 {
+			fmt.Fprintln(os.Stderr, "The passphrase must not be empty, try again.")
+			continue
+		}
+
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			log.Fatalf("Failed to read passphrase: %v", err)
+		}
+		if string(again) == string(passphrase) {
+			return string(passphrase)
+		}
+		fmt.Fprintln(os.Stderr, "Passphrases do not match, try again.")
+	}
+}
+
+// readLine reads up to a newline one byte at a time, so nothing after it
+// is taken from f.
+func readLine(f *os.File) string {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := f.Read(b)
+		if n == 0 || err != nil || b[0] == '\n' {
+			break
+		}
+		line = append(line, b[0])
+	}
+	return strings.TrimRight(string(line), "\r")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/index"
+)
+
+// lookupTimeout bounds a !lookup including the documents it fetches.
+const lookupTimeout = time.Minute
+
+// showIndex prints what the local index holds for key without fetching.
+func (c *chat) showIndex(key string) {
+	refs := c.node.Index.Lookup(key)
+	if len(refs) == 0 {
+		fmt.Printf("Nothing indexed under %s (%d keys in index)\n", index.NormalizeKey(key), c.node.Index.Keys())
+		return
+	}
+
+	fmt.Printf("%s: %d reference(s)\n", index.NormalizeKey(key), len(refs))
+	for _, ref := range refs {
+		if index.IsLink(ref) {
+			fmt.Printf("  -> %s\n", ref)
+		} else if _, ok := c.node.CachedMessage(ref); ok {
+			fmt.Printf("  %s (cached)\n", ref)
+		} else {
+			fmt.Printf("  %s\n", ref)
+		}
+	}
+}
+
+// lookup resolves key in the background, fetching linked documents, and
+// prints the messages found.
+func (c *chat) lookup(key string) {
+	fmt.Printf("Looking up %s...\n", index.NormalizeKey(key))
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+		defer cancel()
+
+		found, err := c.node.Lookup(ctx, key)
+		if err != nil {
+			log.Printf("Lookup of %s incomplete: %v", key, err)
+		}
+		hashes := make([]string, 0, len(found))
+		for hash := range found {
+			hashes = append(hashes, hash)
+		}
+		if len(hashes) == 0 {
+			fmt.Printf("\nNo messages found for %s\n> ", key)
+			return
+		}
+		sort.Slice(hashes, func(i, j int) bool {
+			return found[hashes[i]].Timestamp.After(found[hashes[j]].Timestamp)
+		})
+
+		fmt.Printf("\nFound %d message(s) for %s:\n", len(hashes), key)
+		for i, hash := range hashes {
+			msg := found[hash]
+			text := c.node.MessageText(hash, msg)
+			if len(text) > 70 {
+				text = text[:70] + "..."
+			}
+
+			fmt.Printf("%d. [%s] %s\n", i+1, shortHash(hash), msg.Timestamp.Format("2006-01-02 15:04:05"))
+			if len(msg.Tags) > 0 {
+				fmt.Printf("   Tags: %s\n", strings.Join(msg.Tags, ", "))
+			}
+			fmt.Printf("   \"%s\"\n", text)
+		}
+		fmt.Print("> ")
+	}()
+}
@@ -1,40 +1,76 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/json"
+	"context"
+	"crypto/ed25519"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"regexp"
+	"os/signal"
+	"sort"
 	"strings"
-	"time"
-
-	"github.com/nats-io/nats.go"
+	"sync"
+	"syscall"
 
+	"github.com/lapingvino/eolnpoc/feed"
+	"github.com/lapingvino/eolnpoc/hub"
+	"github.com/lapingvino/eolnpoc/location"
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/node"
 	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/signing"
+	"github.com/lapingvino/eolnpoc/transport"
 )
 
 const (
 	defaultNATSURL = "nats://demo.nats.io:4222"
-	natsSubject    = "oln.messages.v1"
+
+	defaultHTTPAddr = ":8080"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [listen|publish|chat|server] [args...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [listen|publish|chat|serve|crawl|query|hub|identity|server] [args...]\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\nCommands:\n")
-		fmt.Fprintf(os.Stderr, "  listen                    - Listen for OLN messages\n")
-		fmt.Fprintf(os.Stderr, "  publish <message>         - Publish a message to OLN network\n")
+		fmt.Fprintf(os.Stderr, "  listen [options]          - Listen for OLN messages\n")
+		fmt.Fprintf(os.Stderr, "  publish [options] <msg>   - Publish a message to OLN network\n")
 		fmt.Fprintf(os.Stderr, "  chat [options]            - Interactive chat mode with message caching\n")
+		fmt.Fprintf(os.Stderr, "  serve [options]           - Cache messages and serve them as a JSON feed over HTTP\n")
+		fmt.Fprintf(os.Stderr, "  crawl [options] <url...>  - Fetch HTTP feeds and follow their feed links\n")
+		fmt.Fprintf(os.Stderr, "  query [options]           - Ask nodes for cached messages and collect the replies\n")
+		fmt.Fprintf(os.Stderr, "  hub [options] [command]   - Run an embedded NATS hub, and a command on it\n")
+		fmt.Fprintf(os.Stderr, "  identity <command>        - Manage identities: new, list, export, import\n")
 		fmt.Fprintf(os.Stderr, "  server <nats-url>         - Set NATS server URL (default: %s)\n", defaultNATSURL)
 		fmt.Fprintf(os.Stderr, "\nChat options:\n")
 		fmt.Fprintf(os.Stderr, "  --tag=<tags>              - Comma-separated hashtags to filter (e.g., #OLN,#test)\n")
 		fmt.Fprintf(os.Stderr, "  --location=<pluscode>     - Location filter (pluscode format)\n")
+		fmt.Fprintf(os.Stderr, "  --rules=<path>            - Rules file of messages to hide\n")
 		fmt.Fprintf(os.Stderr, "  --max-cache=N             - Max messages to cache (default: 100)\n")
-		fmt.Fprintf(os.Stderr, "  --rebroadcast=Xm          - Rebroadcast interval (default: 5m)\n")
+		fmt.Fprintf(os.Stderr, "  --rebroadcast=Xm          - Cache sync interval (default: 5m)\n")
 		fmt.Fprintf(os.Stderr, "  --auto-pow=N              - Auto-apply N-bit PoW to all messages\n")
+		fmt.Fprintf(os.Stderr, "  --radius=M                - Metres within which locations count as nearby (default: 10000)\n")
 		fmt.Fprintf(os.Stderr, "  --server=<url>            - NATS server URL\n")
+		fmt.Fprintf(os.Stderr, "  --key=<path>              - Identity key file (default: %s)\n", defaultKeyPath())
+		fmt.Fprintf(os.Stderr, "  --identity=<name>         - Keystore identity to send as, instead of --key\n")
+		fmt.Fprintf(os.Stderr, "  --keystore=<dir>          - Identity directory (default: %s)\n", defaultKeystore())
+		fmt.Fprintf(os.Stderr, "  --contacts=<path>         - Contact list file (default: %s)\n", defaultContactsPath())
+		fmt.Fprintf(os.Stderr, "  --sig-policy=<policy>     - flag, drop-forged or drop-unsigned (default: flag)\n")
+		fmt.Fprintf(os.Stderr, "  --http=<addr>             - Also serve the feed over HTTP (serve default: %s)\n", defaultHTTPAddr)
+		fmt.Fprintf(os.Stderr, "  --name=<name>             - Server name in published documents\n")
+		fmt.Fprintf(os.Stderr, "  --link=<url>              - Public URL of this node's feed\n")
+		fmt.Fprintf(os.Stderr, "  --feeds=<urls>            - Comma-separated other feeds to announce\n")
+		fmt.Fprintf(os.Stderr, "  --crawl=<urls>            - Comma-separated feeds to crawl in the background\n")
+		fmt.Fprintf(os.Stderr, "  --crawl-interval=10m      - How often to crawl them\n")
+		fmt.Fprintf(os.Stderr, "  --push=<urls>             - Comma-separated nodes to push our messages to\n")
+		fmt.Fprintf(os.Stderr, "  --accept-push             - Accept messages POSTed to the HTTP feed\n")
+		fmt.Fprintf(os.Stderr, "  --push-min-pow=N          - PoW bits required on pushed messages (default: 0)\n")
+		fmt.Fprintf(os.Stderr, "\nServe takes the same options as chat.\n")
+		fmt.Fprintf(os.Stderr, "\nCrawl options: --depth=2 --max-feeds=50 --delay=1s --sig-policy=<policy>\n")
+		fmt.Fprintf(os.Stderr, "\nQuery options: --tag=<tags> --plustag=<code> --origin=<key> --since=24h --limit=N --timeout=3s --sig-policy=<policy>\n")
+		fmt.Fprintf(os.Stderr, "\nHub options: --listen=%s --route=<nats-urls> --name=<name>\n", hub.DefaultAddr)
+		fmt.Fprintf(os.Stderr, "\nPublish options: --key=<path> --identity=<name> --keystore=<dir> --push=<urls>\n")
+		fmt.Fprintf(os.Stderr, "Listen options:  --sig-policy=<policy> --tag=<tags> --location=<pluscodes>\n")
 		os.Exit(1)
 	}
 
@@ -42,17 +78,12 @@ func main() {
 	natsURL := defaultNATSURL
 
 	switch command {
-	case "listen":
-		listenCommand(natsURL)
-	case "publish":
-		if len(os.Args) < 3 {
-			fmt.Fprintf(os.Stderr, "Error: publish requires a message\n")
-			os.Exit(1)
-		}
-		message := strings.Join(os.Args[2:], " ")
-		publishCommand(natsURL, message)
-	case "chat":
-		chatCommand(natsURL, os.Args[2:])
+	case "crawl":
+		crawlCommand(os.Args[2:])
+	case "hub":
+		hubCommand(os.Args[2:])
+	case "identity":
+		identityCommand(os.Args[2:])
 	case "server":
 		if len(os.Args) < 3 {
 			fmt.Fprintf(os.Stderr, "Error: server requires a URL\n")
@@ -60,81 +91,135 @@ func main() {
 		}
 		natsURL = os.Args[2]
 		if len(os.Args) > 3 {
-			command = os.Args[3]
-			switch command {
-			case "listen":
-				listenCommand(natsURL)
-			case "publish":
-				if len(os.Args) < 5 {
-					fmt.Fprintf(os.Stderr, "Error: publish requires a message\n")
-					os.Exit(1)
-				}
-				message := strings.Join(os.Args[4:], " ")
-				publishCommand(natsURL, message)
-			default:
-				fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
-				os.Exit(1)
-			}
+			runCommand(natsURL, os.Args[3], os.Args[4:])
 		} else {
 			fmt.Printf("NATS server set to: %s\n", natsURL)
 		}
+	default:
+		runCommand(natsURL, command, os.Args[2:])
+	}
+}
+
+// runCommand runs one of the commands that talk to a NATS server.
+func runCommand(natsURL, command string, args []string) {
+	switch command {
+	case "listen":
+		listenCommand(natsURL, args)
+	case "publish":
+		publishCommand(natsURL, args)
+	case "chat":
+		chatCommand(natsURL, args)
+	case "serve":
+		serveCommand(natsURL, args)
+	case "query":
+		queryCommand(natsURL, args)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
 		os.Exit(1)
 	}
 }
 
-func connectNATS(url string) *nats.Conn {
-	nc, err := nats.Connect(url)
+func connectNATS(url string) *transport.NATS {
+	t, err := transport.NewNATS(url)
 	if err != nil {
 		log.Fatalf("Failed to connect to NATS at %s: %v", url, err)
 	}
-	return nc
+	return t
 }
 
-func extractHashtags(text string) []string {
-	re := regexp.MustCompile(`#\w+`)
-	matches := re.FindAllString(text, -1)
-	uniqueTags := make(map[string]bool)
-	for _, tag := range matches {
-		uniqueTags[tag] = true
+func defaultKeyPath() string {
+	path, err := signing.DefaultKeyPath()
+	if err != nil {
+		return "identity.key"
 	}
-	var tags []string
-	for tag := range uniqueTags {
-		tags = append(tags, tag)
+	return path
+}
+
+func loadIdentity(path string) ed25519.PrivateKey {
+	key, err := signing.LoadOrCreateKey(path)
+	if err != nil {
+		log.Fatalf("Failed to load identity from %s: %v", path, err)
 	}
-	return tags
+	return key
 }
 
-func generateHash(content string) string {
-	hash := sha256.Sum256([]byte(content))
-	return fmt.Sprintf("%x", hash)[:16] // Use first 16 chars for readability
+func parseSigPolicy(name string) signing.Policy {
+	policy, err := signing.ParsePolicy(name)
+	if err != nil {
+		log.Fatalf("Invalid signature policy: %v", err)
+	}
+	return policy
 }
 
-func createMessage(text string) olnjson.Message {
-	tags := extractHashtags(text)
+// splitList splits a comma-separated option value, dropping empty items.
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// waitForInterrupt blocks until the process receives Ctrl+C or SIGTERM.
+func waitForInterrupt() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+}
+
+// generateHash returns the content ID under which msg is published.
+func generateHash(msg olnjson.Message) string {
+	hash, err := multihash.Sum(msg)
+	if err != nil {
+		log.Fatalf("Failed to hash message: %v", err)
+	}
+	return hash
+}
 
-	return olnjson.Message{
+func createMessage(text string, tags []string, key ed25519.PrivateKey, origin olnjson.Origin) olnjson.Message {
+	msg := olnjson.Message{
 		Raw:       text,
-		Timestamp: time.Now(),
+		Timestamp: olnjson.Now(),
 		TTL:       7, // 7 days
 		Hops:      0,
 		Tags:      tags,
-		Sig:       "", // TODO: signing
-		Origin: olnjson.Origin{
-			Display:    "anonymous",
-			PubKey:     "",
-			ServerName: "",
-		},
+		Origin:    origin,
 	}
+	if msg.Origin.Display == "" {
+		msg.Origin.Display = "anonymous"
+	}
+	if err := signing.Sign(key, &msg); err != nil {
+		log.Fatalf("Failed to sign message: %v", err)
+	}
+	return msg
 }
 
-func publishCommand(natsURL, messageText string) {
-	nc := connectNATS(natsURL)
-	defer nc.Close()
+func publishCommand(natsURL string, args []string) {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	keyPath := fs.String("key", defaultKeyPath(), "Identity key file")
+	identity := fs.String("identity", "", "Keystore identity to send as, instead of --key")
+	storeDir := fs.String("keystore", "", "Identity directory (default: "+defaultKeystore()+")")
+	push := fs.String("push", "", "Comma-separated push URLs to also send the message to")
+	near := fs.String("location", "", "Full plus code to recover short codes in the message relative to")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: publish requires a message\n")
+		os.Exit(1)
+	}
+	messageText := strings.Join(fs.Args(), " ")
+	key, origin := chooseIdentity(*keyPath, *storeDir, *identity)
+
+	t := connectNATS(natsURL)
+	defer t.Close()
 
-	msg := createMessage(messageText)
-	msgHash := generateHash(messageText)
+	// Plustags are tags too, so the message reaches followers of its area
+	tags, indexKeys := node.MessageTags(messageText, strings.ToUpper(*near))
+	msg := createMessage(messageText, tags, key, origin)
+	msgHash := generateHash(msg)
 
 	// Create OLN Format with the message
 	format := olnjson.Format{
@@ -142,7 +227,7 @@ func publishCommand(natsURL, messageText string) {
 			Link:       "oln.local",
 			Name:       "OLN Node",
 			PubKey:     "",
-			AcceptPush: true,
+			AcceptPush: false,
 		},
 		Messages: map[string]olnjson.Message{
 			msgHash: msg,
@@ -152,21 +237,19 @@ func publishCommand(natsURL, messageText string) {
 		Push:  []string{},
 	}
 
-	// Add tags to index
-	for _, tag := range msg.Tags {
-		format.Index[tag] = append(format.Index[tag], msgHash)
+	for _, key := range indexKeys {
+		format.Index[key] = append(format.Index[key], msgHash)
 	}
 
-	// Marshal to JSON
-	jsonData, err := json.Marshal(format)
-	if err != nil {
-		log.Fatalf("Failed to marshal message: %v", err)
+	if err := node.PublishAll(t, &format, msg.Tags); err != nil {
+		log.Fatalf("Failed to publish message: %v", err)
 	}
 
-	// Publish to NATS
-	err = nc.Publish(natsSubject, jsonData)
-	if err != nil {
-		log.Fatalf("Failed to publish message: %v", err)
+	client := feed.NewClient()
+	for _, url := range splitList(*push) {
+		if _, err := client.Push(context.Background(), url, &format); err != nil {
+			log.Printf("Push to %s failed: %v", url, err)
+		}
 	}
 
 	fmt.Printf("Published: %s\n", messageText)
@@ -176,13 +259,17 @@ func publishCommand(natsURL, messageText string) {
 	}
 }
 
-func displayMessage(format *olnjson.Format) {
-	if len(format.Messages) == 0 {
-		return
-	}
-
+func displayMessage(format *olnjson.Format, policy signing.Policy) {
 	for hash, msg := range format.Messages {
-		fmt.Printf("\n[%s] %s\n", msg.Timestamp.Format("2006-01-02 15:04:05"), hash)
+		if err := multihash.Verify(hash, msg); err != nil {
+			log.Printf("Rejected message %s: %v", hash, err)
+			continue
+		}
+		status := signing.Check(msg)
+		if !policy.Accepts(status) {
+			continue
+		}
+		fmt.Printf("\n[%s] %s [%s]\n", msg.Timestamp.Format("2006-01-02 15:04:05"), hash, status)
 		if len(msg.Tags) > 0 {
 			fmt.Printf("  Tags: %s\n", strings.Join(msg.Tags, ", "))
 		}
@@ -191,29 +278,61 @@ func displayMessage(format *olnjson.Format) {
 		}
 		fmt.Printf("  %s\n", msg.Raw)
 	}
+
+	if len(format.Index) > 0 {
+		keys := make([]string, 0, len(format.Index))
+		for key, refs := range format.Index {
+			keys = append(keys, fmt.Sprintf("%s (%d)", key, len(refs)))
+		}
+		sort.Strings(keys)
+		fmt.Printf("\nIndex from %s: %s\n", format.Server.Name, strings.Join(keys, ", "))
+	}
 }
 
-func listenCommand(natsURL string) {
-	nc := connectNATS(natsURL)
-	defer nc.Close()
+func listenCommand(natsURL string, args []string) {
+	fs := flag.NewFlagSet("listen", flag.ExitOnError)
+	sigPolicy := fs.String("sig-policy", "flag", "Signature policy: flag, drop-forged or drop-unsigned")
+	tags := fs.String("tag", "", "Only receive messages with these comma-separated hashtags")
+	locations := fs.String("location", "", "Only receive messages located in these comma-separated plus code areas")
+	fs.Parse(args)
+	policy := parseSigPolicy(*sigPolicy)
 
-	fmt.Printf("Listening on %s for OLN messages...\n", natsSubject)
+	for _, code := range splitList(*locations) {
+		if !location.ValidatePluscode(strings.ToUpper(code)) {
+			log.Fatalf("Invalid location: %s", code)
+		}
+	}
+	subjects := node.FilterSubjects(splitList(*tags), splitList(*locations))
+
+	t := connectNATS(natsURL)
+	defer t.Close()
+	t.OnError = func(err error) {
+		log.Printf("Error parsing message: %v", err)
+	}
+
+	fmt.Printf("Listening on %s for OLN messages...\n", strings.Join(subjects, ", "))
 	fmt.Printf("Connected to: %s\n", natsURL)
 	fmt.Println("Press Ctrl+C to stop")
 	fmt.Println(strings.Repeat("-", 60))
 
-	_, err := nc.Subscribe(natsSubject, func(m *nats.Msg) {
-		var format olnjson.Format
-		err := json.Unmarshal(m.Data, &format)
+	// A message can arrive on several subjects, show it once
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	for _, subject := range subjects {
+		_, err := t.Subscribe(subject, func(format *olnjson.Format) {
+			mu.Lock()
+			defer mu.Unlock()
+			for hash := range format.Messages {
+				if seen[hash] {
+					delete(format.Messages, hash)
+				}
+				seen[hash] = true
+			}
+			displayMessage(format, policy)
+		})
 		if err != nil {
-			log.Printf("Error parsing message: %v", err)
-			return
+			log.Fatalf("Failed to subscribe: %v", err)
 		}
-		displayMessage(&format)
-	})
-
-	if err != nil {
-		log.Fatalf("Failed to subscribe: %v", err)
 	}
 
 	// Keep running
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/node"
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// parseFetchArgs reads the arguments of !fetch: #tags, a plus code,
+// since=<time> and from=<pubkey or name>, in any order.
+func parseFetchArgs(args []string) (olnjson.Query, error) {
+	var q olnjson.Query
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "#"):
+			q.Tags = append(q.Tags, arg)
+		case strings.HasPrefix(arg, "since="):
+			since, err := node.ParseSince(strings.TrimPrefix(arg, "since="))
+			if err != nil {
+				return q, err
+			}
+			q.Since = since
+		case strings.HasPrefix(arg, "from="):
+			q.Origin = strings.TrimPrefix(arg, "from=")
+		default:
+			if _, err := node.NewFeedQuery(nil, arg, "", time.Time{}); err != nil {
+				return q, fmt.Errorf("unknown argument: %s", arg)
+			}
+			q.Plustag = strings.ToUpper(arg)
+		}
+	}
+	return q, nil
+}
+
+// fetch asks the other nodes for messages in the background and reports
+// when the timeout passed, unless quiet is set.
+func (c *chat) fetch(q olnjson.Query, quiet bool) {
+	go func() {
+		fresh, replies, err := c.node.Fetch(q, node.DefaultQueryTimeout)
+		if err != nil {
+			log.Printf("Fetch failed: %v", err)
+			return
+		}
+		if !quiet {
+			fmt.Printf("\nFetched %d new message(s) from %d node(s)\n> ", fresh, replies)
+		}
+	}()
+}
+
+func queryCommand(natsURL string, args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	tags := fs.String("tag", "", "Comma-separated hashtags, any of which must match")
+	plustag := fs.String("plustag", "", "Plus code area the messages must be located in")
+	origin := fs.String("origin", "", "Public key or display name of the sender")
+	since := fs.String("since", "", "Only messages since this time (RFC 3339, Unix seconds or a duration like 24h)")
+	limit := fs.Int("limit", 0, "Maximum number of messages per node")
+	timeout := fs.Duration("timeout", node.DefaultQueryTimeout, "How long to wait for replies")
+	sigPolicy := fs.String("sig-policy", "flag", "Signature policy: flag, drop-forged or drop-unsigned")
+	fs.Parse(args)
+	policy := parseSigPolicy(*sigPolicy)
+
+	q := olnjson.Query{
+		Tags:    splitList(*tags),
+		Plustag: strings.ToUpper(*plustag),
+		Origin:  *origin,
+		Limit:   *limit,
+	}
+	if *since != "" {
+		t, err := node.ParseSince(*since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid query: %v\n", err)
+			os.Exit(1)
+		}
+		q.Since = t
+	}
+	if _, err := node.NewFeedQuery(q.Tags, q.Plustag, q.Origin, q.Since); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid query: %v\n", err)
+		os.Exit(1)
+	}
+
+	t := connectNATS(natsURL)
+	defer t.Close()
+
+	fmt.Printf("Querying %s for %s...\n", natsURL, *timeout)
+
+	// Merge replies from all nodes, showing each message once
+	seen := make(map[string]bool)
+	replies := 0
+	err := node.SendQuery(t, olnjson.ServerInfo{Name: "OLN Query"}, q, *timeout, func(format *olnjson.Format) {
+		replies++
+		fresh := olnjson.Format{Messages: make(map[string]olnjson.Message)}
+		for hash, msg := range format.Messages {
+			if seen[hash] {
+				continue
+			}
+			// A forged copy must not hide the genuine one
+			if err := multihash.Verify(hash, msg); err != nil {
+				log.Printf("Rejected message %s: %v", hash, err)
+				continue
+			}
+			seen[hash] = true
+			fresh.Messages[hash] = msg
+		}
+		displayMessage(&fresh, policy)
+	})
+	if err != nil {
+		log.Fatalf("Query failed: %v", err)
+	}
+
+	fmt.Println(strings.Repeat("-", 60))
+	fmt.Printf("%d node(s) replied, %d unique message(s)\n", replies, len(seen))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/node"
+)
+
+// handleRuleCommand handles the !filter actions that manage rules.
+func (c *chat) handleRuleCommand(action string, args []string) {
+	if len(args) == 0 {
+		fmt.Printf("Usage: !filter %s <value>\n", action)
+		return
+	}
+	value := strings.Join(args, " ")
+
+	switch action {
+	case "mute":
+		tags := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+		for _, tag := range c.node.MuteTags(tags...) {
+			fmt.Printf("Muted: %s\n", tag)
+		}
+
+	case "unmute":
+		if c.node.UnmuteTag(value) {
+			fmt.Printf("Unmuted: %s\n", value)
+		} else {
+			fmt.Printf("Not muted: %s\n", value)
+		}
+
+	case "block", "unblock":
+		// Petnames stand for their key, anything else is taken as it is
+		origin := value
+		if pubKey, err := c.node.Contacts.Resolve(value); err == nil {
+			origin = pubKey
+		}
+		if action == "block" {
+			if c.node.BlockOrigin(origin) {
+				fmt.Printf("Blocked: %s\n", value)
+			} else {
+				fmt.Printf("Already blocked: %s\n", value)
+			}
+		} else if c.node.UnblockOrigin(origin) {
+			fmt.Printf("Unblocked: %s\n", value)
+		} else {
+			fmt.Printf("Not blocked: %s\n", value)
+		}
+
+	case "word":
+		if err := c.node.AddWordFilter(value); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Added word filter: %s\n", value)
+
+	case "unword":
+		if c.node.RemoveWordFilter(value) {
+			fmt.Printf("Removed word filter: %s\n", value)
+		} else {
+			fmt.Printf("Word filter not found: %s\n", value)
+		}
+
+	case "min-pow":
+		bits, err := strconv.Atoi(value)
+		if err != nil || bits < 0 {
+			fmt.Println("Invalid bits value")
+			return
+		}
+		c.node.SetUnknownMinPoW(bits)
+		if bits == 0 {
+			fmt.Println("Unknown senders need no PoW")
+		} else {
+			fmt.Printf("Unknown senders need %d bits of PoW\n", bits)
+		}
+
+	case "load":
+		rules, err := node.LoadRules(value)
+		if err == nil {
+			err = c.node.SetRules(rules)
+		}
+		if err != nil {
+			fmt.Printf("Error loading rules: %v\n", err)
+			return
+		}
+		fmt.Printf("Loaded %d muted tag(s), %d blocked sender(s), %d word filter(s) from %s\n",
+			len(rules.MutedTags), len(rules.BlockedOrigins), len(rules.Words), value)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/node"
+	"github.com/lapingvino/eolnpoc/parser"
+)
+
+// reply answers a cached message.
+func (c *chat) reply(hashPrefix, text string) {
+	entry, ok := c.node.FindEntry(hashPrefix)
+	if !ok {
+		fmt.Printf("Message not found: %s\n", hashPrefix)
+		return
+	}
+
+	hash, err := c.node.Reply(entry.Hash, text)
+	if err != nil {
+		fmt.Printf("Error replying: %v\n", err)
+		return
+	}
+	fmt.Printf("Replied to %s (hash: %s)\n", entry.Hash[:8], hash[:8])
+}
+
+// showThread prints the conversation a message is part of. Messages it
+// goes back to that are not cached are asked from the other nodes first,
+// in the background.
+func (c *chat) showThread(hashPrefix string) {
+	hash := hashPrefix
+	if entry, ok := c.node.FindEntry(hashPrefix); ok {
+		hash = entry.Hash
+	} else if !multihash.IsID(hashPrefix) {
+		fmt.Printf("Message not found: %s\n", hashPrefix)
+		return
+	}
+
+	if root, missing := c.node.Thread(hash); missing == "" {
+		printThread(root)
+		return
+	}
+
+	fmt.Println("Fetching missing messages of the thread...")
+	go func() {
+		root, err := c.node.FetchThread(hash, node.DefaultQueryTimeout)
+		if err != nil {
+			fmt.Printf("\nFetching thread failed: %v\n> ", err)
+			return
+		}
+		fmt.Println()
+		printThread(root)
+		fmt.Print("> ")
+	}()
+}
+
+// printThread prints a thread as a tree, replies indented below the
+// message they answer. Messages that could not be found are listed by hash.
+func printThread(root *node.Thread) {
+	var show func(t *node.Thread, depth int)
+	show = func(t *node.Thread, depth int) {
+		indent := strings.Repeat("  ", depth)
+		if depth > 0 {
+			indent = strings.Repeat("  ", depth-1) + "└ "
+		}
+
+		if t.Entry == nil {
+			fmt.Printf("%s[%s] (not available)\n", indent, shortHash(t.Hash))
+		} else {
+			msg := t.Entry.Message
+			from := msg.Origin.Display
+			if from == "" {
+				from = "unknown"
+			}
+			fmt.Printf("%s[%s] %s %s\n", indent, shortHash(t.Hash), msg.Timestamp.Format("2006-01-02 15:04:05"), from)
+			fmt.Printf("%s  %s\n", strings.Repeat("  ", depth), parser.Unpack(t.Entry.Text()))
+		}
+
+		for _, reply := range t.Replies {
+			show(reply, depth+1)
+		}
+	}
+
+	show(root, 0)
+}
+
+// shortHash returns the first 8 characters of a hash for display, or all
+// of it if it is shorter.
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
@@ -0,0 +1,119 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// DefaultMaxSize is the largest document a Client downloads by default.
+const DefaultMaxSize = 4 << 20
+
+// ErrNotModified is returned by Fetch when a feed has not changed since it
+// was last fetched.
+var ErrNotModified = errors.New("feed not modified")
+
+// Client fetches OLN documents over HTTP. It remembers the ETag and
+// Last-Modified headers of every feed, so unchanged feeds are not
+// downloaded again.
+type Client struct {
+	HTTP    *http.Client
+	MaxSize int64 // Maximum document size in bytes
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	etag         string
+	lastModified string
+	feeds        []string
+}
+
+// NewClient returns a client with sensible timeouts and size limits.
+func NewClient() *Client {
+	return &Client{
+		HTTP:    &http.Client{Timeout: 30 * time.Second, Transport: newTransport()},
+		MaxSize: DefaultMaxSize,
+		cache:   make(map[string]cacheEntry),
+	}
+}
+
+// Fetch downloads the document at url. It returns ErrNotModified if the
+// server reports that the feed did not change since the previous Fetch.
+// With a PublicOnly ctx, non-public addresses are refused.
+func (c *Client) Fetch(ctx context.Context, url string) (*olnjson.Format, error) {
+	if isPublicOnly(ctx) {
+		if err := checkURL(url); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	c.mu.Lock()
+	cached, known := c.cache[url]
+	c.mu.Unlock()
+	if known {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > c.MaxSize {
+		return nil, fmt.Errorf("fetching %s: document larger than %d bytes", url, c.MaxSize)
+	}
+
+	var format olnjson.Format
+	if err := json.Unmarshal(data, &format); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", url, err)
+	}
+
+	c.mu.Lock()
+	c.cache[url] = cacheEntry{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		feeds:        format.Feeds,
+	}
+	c.mu.Unlock()
+
+	return &format, nil
+}
+
+// KnownFeeds returns the Feeds list of the last document fetched from url,
+// so a crawl can continue past feeds that were not modified.
+func (c *Client) KnownFeeds(url string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cache[url].feeds
+}
@@ -0,0 +1,131 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// Crawler walks the web of feeds: it fetches documents and follows the
+// links in their Feeds lists breadth-first.
+type Crawler struct {
+	Client   *Client
+	MaxDepth int           // How many links away from the start feeds to go
+	MaxFeeds int           // Maximum number of feeds fetched per crawl, 0 for no limit
+	Delay    time.Duration // Minimum time between two requests
+
+	// Visit is called for every document fetched.
+	Visit func(url string, format *olnjson.Format)
+	// OnError, if set, is called for feeds that could not be fetched.
+	OnError func(url string, err error)
+}
+
+// NewCrawler returns a crawler with a new Client and conservative limits.
+func NewCrawler(visit func(url string, format *olnjson.Format)) *Crawler {
+	return &Crawler{
+		Client:   NewClient(),
+		MaxDepth: 2,
+		MaxFeeds: 50,
+		Delay:    time.Second,
+		Visit:    visit,
+	}
+}
+
+// Crawl fetches the start feeds and everything reachable from them within
+// MaxDepth. Every feed is fetched at most once per crawl. Feeds found in
+// other feeds are only fetched from public addresses, see PublicOnly. It
+// returns early only if ctx is cancelled.
+func (c *Crawler) Crawl(ctx context.Context, start []string) error {
+	type item struct {
+		url   string
+		depth int
+	}
+
+	var queue []item
+	seen := make(map[string]bool)
+	for _, u := range start {
+		if link, ok := normalizeLink(nil, u); ok && !seen[link] {
+			seen[link] = true
+			queue = append(queue, item{link, 0})
+		}
+	}
+
+	fetched := 0
+	var last time.Time
+	for len(queue) > 0 {
+		if c.MaxFeeds > 0 && fetched >= c.MaxFeeds {
+			break
+		}
+		current := queue[0]
+		queue = queue[1:]
+
+		// Rate limit
+		if wait := c.Delay - time.Since(last); !last.IsZero() && wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		last = time.Now()
+		fetched++
+
+		fetchCtx := ctx
+		if current.depth > 0 {
+			fetchCtx = PublicOnly(ctx)
+		}
+
+		var feeds []string
+		format, err := c.Client.Fetch(fetchCtx, current.url)
+		switch {
+		case err == nil:
+			if c.Visit != nil {
+				c.Visit(current.url, format)
+			}
+			feeds = format.Feeds
+		case errors.Is(err, ErrNotModified):
+			feeds = c.Client.KnownFeeds(current.url)
+		default:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if c.OnError != nil {
+				c.OnError(current.url, err)
+			}
+			continue
+		}
+
+		if current.depth >= c.MaxDepth {
+			continue
+		}
+		base, _ := url.Parse(current.url)
+		for _, f := range feeds {
+			if link, ok := normalizeLink(base, f); ok && !seen[link] {
+				seen[link] = true
+				queue = append(queue, item{link, current.depth + 1})
+			}
+		}
+	}
+
+	return nil
+}
+
+// normalizeLink resolves a feed link against the feed it was found in and
+// reports whether it can be fetched over HTTP(S).
+func normalizeLink(base *url.URL, link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	u.Fragment = ""
+	return u.String(), true
+}
@@ -0,0 +1,87 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrNotPublic is returned for requests marked with PublicOnly that would
+// reach a loopback, private or otherwise non-public address.
+var ErrNotPublic = errors.New("address is not public")
+
+type publicOnlyKey struct{}
+
+// PublicOnly marks the requests made with ctx as allowed to reach public
+// addresses only. Use it for links taken from documents of others, so they
+// cannot make us fetch from the local machine or network.
+func PublicOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, publicOnlyKey{}, true)
+}
+
+func isPublicOnly(ctx context.Context) bool {
+	public, _ := ctx.Value(publicOnlyKey{}).(bool)
+	return public
+}
+
+// Carrier-grade NAT space, not covered by netip.Addr.IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublicAddr reports whether addr can be reached over the internet.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// checkURL rejects links that are not http(s), or whose host is a name or
+// address that is obviously not public, before a request is made. The
+// dialer checks the addresses names resolve to.
+func checkURL(link string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s: unsupported scheme %q", link, u.Scheme)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%s: %w", link, ErrNotPublic)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !isPublicAddr(addr) {
+		return fmt.Errorf("%s: %w", link, ErrNotPublic)
+	}
+	return nil
+}
+
+// newTransport returns an HTTP transport whose dialer refuses non-public
+// addresses for requests marked with PublicOnly. Proxies are not used, as
+// the address checked would be that of the proxy.
+func newTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dialer.ControlContext = func(ctx context.Context, network, address string, _ syscall.RawConn) error {
+		if !isPublicOnly(ctx) {
+			return nil
+		}
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil || !isPublicAddr(addrPort.Addr()) {
+			return fmt.Errorf("dialing %s: %w", address, ErrNotPublic)
+		}
+		return nil
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	return t
+}
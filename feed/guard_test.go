@@ -0,0 +1,109 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"224.0.0.1":        false,
+		"::ffff:127.0.0.1": false,
+	}
+	for addr, want := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://example.com/oln.json":  true,
+		"http://93.184.216.34/oln.json": true,
+		"file:///etc/passwd":            false,
+		"gopher://example.com/":         false,
+		"http://localhost:8080/":        false,
+		"http://LOCALHOST./":            false,
+		"http://a.localhost/":           false,
+		"http://127.0.0.1:4222/":        false,
+		"http://[::1]/":                 false,
+		"http://169.254.169.254/latest": false,
+	}
+	for link, want := range tests {
+		if err := checkURL(link); (err == nil) != want {
+			t.Errorf("checkURL(%s) = %v, want allowed %v", link, err, want)
+		}
+	}
+}
+
+func TestCrawlSkipsPrivateLinks(t *testing.T) {
+	var hits int
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		json.NewEncoder(w).Encode(olnjson.Format{Feeds: []string{server.URL + "/other"}})
+	}))
+	defer server.Close()
+
+	var visited []string
+	var failed error
+	crawler := NewCrawler(func(url string, format *olnjson.Format) {
+		visited = append(visited, url)
+	})
+	crawler.Delay = 0
+	crawler.OnError = func(url string, err error) { failed = err }
+
+	if err := crawler.Crawl(context.Background(), []string{server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if len(visited) != 1 || visited[0] != server.URL {
+		t.Errorf("visited %v, want only the start feed", visited)
+	}
+	if hits != 1 {
+		t.Errorf("server got %d requests, want 1", hits)
+	}
+	if !errors.Is(failed, ErrNotPublic) {
+		t.Errorf("linked feed failed with %v, want ErrNotPublic", failed)
+	}
+}
+
+func TestPublicOnlyDial(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(olnjson.Format{})
+	}))
+	defer server.Close()
+
+	// A name resolving to a loopback address passes checkURL, so the
+	// dialer has to catch it
+	client := NewClient()
+	req, err := http.NewRequestWithContext(PublicOnly(context.Background()), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.HTTP.Do(req); !errors.Is(err, ErrNotPublic) {
+		t.Errorf("request to %s: %v, want ErrNotPublic", server.URL, err)
+	}
+	if _, err := client.Fetch(context.Background(), server.URL); err != nil {
+		t.Errorf("unmarked request: %v", err)
+	}
+}
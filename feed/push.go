@@ -0,0 +1,57 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// PushResult is the reply of a node to a pushed document.
+type PushResult struct {
+	Accepted []string          `json:"accepted"` // Hashes of the messages that were taken
+	Rejected map[string]string `json:"rejected"` // Reasons by hash for the ones that were not
+}
+
+// Push sends format to the push endpoint at url, which is usually the feed
+// link of a node announcing acceptpush.
+func (c *Client) Push(ctx context.Context, url string, format *olnjson.Format) (*PushResult, error) {
+	data, err := json.Marshal(format)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > c.MaxSize {
+		return nil, fmt.Errorf("pushing to %s: document larger than %d bytes", url, c.MaxSize)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.MaxSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pushing to %s: %s: %s", url, resp.Status, bytes.TrimSpace(body))
+	}
+
+	var result PushResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parsing reply from %s: %v", url, err)
+	}
+	return &result, nil
+}
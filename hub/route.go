@@ -0,0 +1,74 @@
+package hub
+
+import (
+	"log"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Routes identify themselves with this prefix in the CONNECT name and
+// present the route token, so the hub on the other end does not pass what
+// they publish on to its own routes.
+const routeNamePrefix = "oln-hub-route:"
+
+// route is our connection to another hub. The OLN subjects published there
+// come in over it, and those our clients publish go out over it.
+type route struct {
+	url string
+	nc  *nats.Conn
+}
+
+// dialRoute connects to the hub at url. If it cannot be reached yet the
+// connection is retried in the background, so hubs can start in any order.
+func (s *Server) dialRoute(url string) (*route, error) {
+	opts := []nats.Option{
+		nats.Name(routeNamePrefix + s.opts.Name),
+		nats.NoEcho(),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ConnectHandler(func(*nats.Conn) {
+			log.Printf("Hub route to %s connected", url)
+		}),
+		nats.ReconnectHandler(func(*nats.Conn) {
+			log.Printf("Hub route to %s reconnected", url)
+		}),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("Hub route to %s lost: %v", url, err)
+			}
+		}),
+	}
+	if s.opts.RouteToken != "" {
+		opts = append(opts, nats.Token(s.opts.RouteToken))
+	}
+	if s.opts.RouteTLS != nil {
+		opts = append(opts, nats.Secure(s.opts.RouteTLS))
+	}
+	nc, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &route{url: url, nc: nc}
+	_, err = nc.Subscribe(routeSubjects, func(m *nats.Msg) {
+		s.deliver(nil, m.Subject, m.Reply, m.Data)
+	})
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// forward publishes a message of one of our clients on the other hub.
+// While the route is down messages are buffered by the connection.
+func (r *route) forward(subject, reply string, payload []byte) {
+	err := r.nc.PublishMsg(&nats.Msg{Subject: subject, Reply: reply, Data: payload})
+	if err != nil {
+		log.Printf("Hub route to %s: %v", r.url, err)
+	}
+}
+
+func (r *route) close() {
+	r.nc.Close()
+}
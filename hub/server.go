@@ -0,0 +1,602 @@
+// Package hub is a small in-process server speaking the NATS client
+// protocol, so OLN nodes can meet without any external infrastructure: on
+// a LAN, at a festival or in a test. It implements what nats.go and the OLN
+// transports need (publish, subscribe with wildcards and queue groups,
+// no-echo, TLS) but no user authentication, headers or JetStream.
+//
+// Hubs can be linked with routes. A route is a plain NATS client
+// connection to another hub (or to any NATS server) over which the OLN
+// subjects are exchanged both ways. This is not NATS clustering: there is
+// no gossip and no route discovery, and messages are passed on over one
+// route only, never from one route to the next. A group of hubs acts as
+// one bus if every pair of them is linked once. Hubs recognise each other's
+// routes by a shared token, and refuse connections that claim to be a
+// route without it, so a route can never be mistaken for a client whose
+// messages are passed on again, which would loop around a ring of hubs.
+//
+// The hub is written against the client protocol, rather than embedding
+// nats-server, to keep olnnode a small program depending on nats.go only;
+// a group that needs clustering, leafnodes or accounts should run
+// nats-server and point its nodes at it.
+package hub
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/transport"
+)
+
+const (
+	// DefaultAddr is the standard NATS client port.
+	DefaultAddr = ":4222"
+
+	// DefaultMaxPayload is the largest message accepted from clients.
+	DefaultMaxPayload = 1 << 20
+
+	// Version of the NATS server protocol we claim to speak
+	serverVersion = "2.10.0"
+
+	// Subjects exchanged over routes. Other traffic on a server we route
+	// to, like the rest of a public one, stays there.
+	routeSubjects = "oln.>"
+
+	// Clients that don't read for this long, or fall this many protocol
+	// messages behind, are disconnected as slow consumers
+	writeTimeout = 10 * time.Second
+	maxPending   = 4096
+
+	maxControlLine = 4096
+)
+
+// Options configure a Server.
+type Options struct {
+	Addr       string   // Address to accept clients on, DefaultAddr if empty
+	Name       string   // Announced to clients and used to name routes
+	Routes     []string // NATS URLs of other hubs to link with
+	MaxPayload int      // DefaultMaxPayload if 0
+
+	// RouteToken is the secret hubs link with. Our routes present it, and
+	// only clients presenting it are taken for routes of other hubs;
+	// clients claiming to be a route without it are refused. Required if
+	// Routes are given.
+	RouteToken string
+
+	// TLS, if set, is required of every client.
+	TLS *tls.Config
+	// RouteTLS, if set, is used for routes to tls:// URLs or to servers
+	// requiring TLS, for example to trust a self-signed certificate.
+	RouteTLS *tls.Config
+}
+
+// Server is a running hub.
+type Server struct {
+	opts     Options
+	id       string
+	listener net.Listener
+
+	mu      sync.RWMutex
+	clients map[*client]bool
+	routes  []*route
+	lastCID uint64
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// Start listens on opts.Addr, connects the routes and accepts clients in
+// the background until Close is called.
+func Start(opts Options) (*Server, error) {
+	if opts.Addr == "" {
+		opts.Addr = DefaultAddr
+	}
+	if opts.MaxPayload == 0 {
+		opts.MaxPayload = DefaultMaxPayload
+	}
+	if len(opts.Routes) > 0 && opts.RouteToken == "" {
+		return nil, errors.New("routes need a route token")
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	if opts.Name == "" {
+		opts.Name = "oln-hub-" + hex.EncodeToString(id[:4])
+	}
+
+	ln, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		opts:     opts,
+		id:       hex.EncodeToString(id[:]),
+		listener: ln,
+		clients:  make(map[*client]bool),
+	}
+
+	for _, url := range opts.Routes {
+		r, err := s.dialRoute(url)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("route %s: %v", url, err)
+		}
+		s.routes = append(s.routes, r)
+	}
+
+	s.wg.Add(1)
+	go s.acceptLoop()
+	return s, nil
+}
+
+// Addr returns the address the hub listens on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// ClientURL returns a URL local clients can connect to.
+func (s *Server) ClientURL() string {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	host := addr.IP.String()
+	if addr.IP.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	scheme := "nats://"
+	if s.opts.TLS != nil {
+		scheme = "tls://"
+	}
+	return scheme + net.JoinHostPort(host, strconv.Itoa(addr.Port))
+}
+
+// NumClients returns the number of connected clients, including the routes
+// of other hubs.
+func (s *Server) NumClients() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.clients)
+}
+
+// Close disconnects all clients and routes and stops listening.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	clients := s.clients
+	s.clients = make(map[*client]bool)
+	routes := s.routes
+	s.mu.Unlock()
+
+	err := s.listener.Close()
+	for c := range clients {
+		c.conn.Close()
+	}
+	for _, r := range routes {
+		r.close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.lastCID++
+		c := newClient(s, conn, s.lastCID)
+		s.clients[c] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.run()
+			s.mu.Lock()
+			delete(s.clients, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+type serverInfo struct {
+	ID          string `json:"server_id"`
+	Name        string `json:"server_name"`
+	Version     string `json:"version"`
+	Proto       int    `json:"proto"`
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	Headers     bool   `json:"headers"`
+	MaxPayload  int    `json:"max_payload"`
+	ClientID    uint64 `json:"client_id"`
+	TLSRequired bool   `json:"tls_required"`
+}
+
+func (s *Server) info(cid uint64) serverInfo {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return serverInfo{
+		ID:          s.id,
+		Name:        s.opts.Name,
+		Version:     serverVersion,
+		Proto:       1,
+		Host:        addr.IP.String(),
+		Port:        addr.Port,
+		MaxPayload:  s.opts.MaxPayload,
+		ClientID:    cid,
+		TLSRequired: s.opts.TLS != nil,
+	}
+}
+
+// deliver sends a message to every matching subscription. from is the
+// client that published it, nil if it came in over one of our routes.
+//
+// Messages only travel one route: those from other hubs are not passed on
+// to further hubs, which would loop in a mesh, and those of our own
+// clients go out over every route.
+func (s *Server) deliver(from *client, subject, reply string, payload []byte) {
+	fromHub := from == nil
+	if from != nil {
+		_, fromHub = from.flags()
+	}
+
+	s.mu.RLock()
+	var targets []*subscription
+	queues := make(map[string][]*subscription)
+	for c := range s.clients {
+		echo, route := c.flags()
+		if c == from && !echo {
+			continue
+		}
+		if fromHub && route {
+			continue
+		}
+		for _, sub := range c.matching(subject) {
+			if sub.queue == "" {
+				targets = append(targets, sub)
+			} else {
+				queues[sub.queue] = append(queues[sub.queue], sub)
+			}
+		}
+	}
+	routes := s.routes
+	s.mu.RUnlock()
+
+	// One member of every queue group gets the message
+	for _, members := range queues {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(members))))
+		if err != nil {
+			continue
+		}
+		targets = append(targets, members[n.Int64()])
+	}
+
+	for _, sub := range targets {
+		sub.client.sendMsg(sub, subject, reply, payload)
+	}
+
+	if !fromHub && transport.MatchSubject(routeSubjects, subject) {
+		for _, r := range routes {
+			r.forward(subject, reply, payload)
+		}
+	}
+}
+
+// isRouteToken reports whether token is the route token of the hub.
+func (s *Server) isRouteToken(token string) bool {
+	return s.opts.RouteToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.RouteToken)) == 1
+}
+
+type subscription struct {
+	client  *client
+	subject string
+	queue   string
+	sid     string
+	max     int // Unsubscribe after this many messages, 0 for never
+	count   int
+}
+
+// client is a connection from a NATS client or another hub's route.
+// Everything sent to it is queued and written by a goroutine of its own,
+// so publishers never wait for a subscriber.
+type client struct {
+	srv  *Server
+	conn net.Conn
+	id   uint64
+
+	out     chan []byte   // Protocol messages waiting to be written
+	done    chan struct{} // Closed when the connection ends
+	written chan struct{} // Closed when the last messages are written
+
+	mu    sync.Mutex
+	subs  map[string]*subscription // By sid
+	echo  bool
+	route bool
+}
+
+func newClient(s *Server, conn net.Conn, id uint64) *client {
+	return &client{
+		srv:     s,
+		conn:    conn,
+		id:      id,
+		out:     make(chan []byte, maxPending),
+		done:    make(chan struct{}),
+		written: make(chan struct{}),
+		subs:    make(map[string]*subscription),
+		echo:    true,
+	}
+}
+
+// run sends INFO and handles the client's protocol messages until the
+// connection is closed or breaks the protocol.
+func (c *client) run() {
+	defer c.conn.Close()
+
+	// INFO goes out in the clear, then clients upgrade to TLS if required
+	info, err := json.Marshal(c.srv.info(c.id))
+	if err != nil {
+		return
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := io.WriteString(c.conn, "INFO "+string(info)+"\r\n"); err != nil {
+		return
+	}
+	var conn net.Conn = c.conn
+	if c.srv.opts.TLS != nil {
+		tlsConn := tls.Server(c.conn, c.srv.opts.TLS)
+		c.conn.SetDeadline(time.Now().Add(writeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		c.conn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+
+	go c.writeLoop(conn)
+	defer func() {
+		close(c.done)
+		<-c.written
+	}()
+
+	r := bufio.NewReaderSize(conn, maxControlLine)
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				c.sendErr("Maximum Control Line Exceeded")
+			}
+			return
+		}
+		if err := c.handle(r, strings.TrimRight(string(line), "\r\n")); err != nil {
+			c.sendErr(err.Error())
+			return
+		}
+	}
+}
+
+func (c *client) handle(r *bufio.Reader, line string) error {
+	op, rest, _ := strings.Cut(line, " ")
+	args := strings.Fields(rest)
+
+	switch strings.ToUpper(op) {
+	case "PING":
+		c.send("PONG\r\n")
+		return nil
+
+	case "PONG", "":
+		return nil
+
+	case "CONNECT":
+		var opts struct {
+			Echo  *bool  `json:"echo"`
+			Name  string `json:"name"`
+			Token string `json:"auth_token"`
+		}
+		if err := json.Unmarshal([]byte(rest), &opts); err != nil {
+			return errors.New("Invalid CONNECT")
+		}
+		// A route served like a client would have its messages passed on
+		// over our routes again
+		route := strings.HasPrefix(opts.Name, routeNamePrefix)
+		if route && !c.srv.isRouteToken(opts.Token) {
+			return errors.New("Authorization Violation")
+		}
+		c.mu.Lock()
+		if opts.Echo != nil {
+			c.echo = *opts.Echo
+		}
+		c.route = route
+		c.mu.Unlock()
+		return nil
+
+	case "SUB":
+		// SUB <subject> [queue] <sid>
+		if len(args) != 2 && len(args) != 3 {
+			return errors.New("Invalid SUB")
+		}
+		sub := &subscription{client: c, subject: args[0], sid: args[len(args)-1]}
+		if len(args) == 3 {
+			sub.queue = args[1]
+		}
+		c.mu.Lock()
+		c.subs[sub.sid] = sub
+		c.mu.Unlock()
+		return nil
+
+	case "UNSUB":
+		// UNSUB <sid> [max]
+		if len(args) != 1 && len(args) != 2 {
+			return errors.New("Invalid UNSUB")
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		sub, ok := c.subs[args[0]]
+		if !ok {
+			return nil
+		}
+		if len(args) == 2 {
+			max, err := strconv.Atoi(args[1])
+			if err != nil {
+				return errors.New("Invalid UNSUB")
+			}
+			if max > sub.count {
+				sub.max = max
+				return nil
+			}
+		}
+		delete(c.subs, sub.sid)
+		return nil
+
+	case "PUB":
+		// PUB <subject> [reply] <size>
+		if len(args) != 2 && len(args) != 3 {
+			return errors.New("Invalid PUB")
+		}
+		size, err := strconv.Atoi(args[len(args)-1])
+		if err != nil || size < 0 {
+			return errors.New("Invalid PUB")
+		}
+		if size > c.srv.opts.MaxPayload {
+			return errors.New("Maximum Payload Violation")
+		}
+		payload := make([]byte, size+2)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+		reply := ""
+		if len(args) == 3 {
+			reply = args[1]
+		}
+		if strings.ContainsAny(args[0], "*>") {
+			return errors.New("Invalid Publish Subject")
+		}
+		c.srv.deliver(c, args[0], reply, payload[:size])
+		return nil
+
+	default:
+		return errors.New("Unknown Protocol Operation")
+	}
+}
+
+// flags returns the echo and route settings from the client's CONNECT.
+func (c *client) flags() (echo, route bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.echo, c.route
+}
+
+// matching returns the client's subscriptions that match subject.
+func (c *client) matching(subject string) []*subscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var result []*subscription
+	for _, sub := range c.subs {
+		if transport.MatchSubject(sub.subject, subject) {
+			result = append(result, sub)
+		}
+	}
+	return result
+}
+
+// sendMsg delivers a message to one of the client's subscriptions.
+func (c *client) sendMsg(sub *subscription, subject, reply string, payload []byte) {
+	c.mu.Lock()
+	if _, ok := c.subs[sub.sid]; !ok {
+		c.mu.Unlock()
+		return
+	}
+	sub.count++
+	if sub.max > 0 && sub.count >= sub.max {
+		delete(c.subs, sub.sid)
+	}
+	c.mu.Unlock()
+
+	header := "MSG " + subject + " " + sub.sid + " "
+	if reply != "" {
+		header += reply + " "
+	}
+	header += strconv.Itoa(len(payload)) + "\r\n"
+
+	msg := make([]byte, 0, len(header)+len(payload)+2)
+	msg = append(msg, header...)
+	msg = append(msg, payload...)
+	msg = append(msg, "\r\n"...)
+	c.enqueue(msg)
+}
+
+// enqueue queues a protocol message for the client. A client too far
+// behind is disconnected; the read loop ends when the connection closes.
+func (c *client) enqueue(msg []byte) {
+	select {
+	case <-c.done:
+	case c.out <- msg:
+	default:
+		c.conn.Close()
+	}
+}
+
+// writeLoop writes the queued protocol messages to conn, flushing whenever
+// the queue runs empty. When the connection ends it writes what is left,
+// like a last -ERR.
+func (c *client) writeLoop(conn net.Conn) {
+	defer close(c.written)
+	w := bufio.NewWriter(conn)
+	for {
+		select {
+		case <-c.done:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			for {
+				select {
+				case msg := <-c.out:
+					w.Write(msg)
+				default:
+					w.Flush()
+					return
+				}
+			}
+		case msg := <-c.out:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			w.Write(msg)
+			if len(c.out) > 0 {
+				continue
+			}
+			if err := w.Flush(); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *client) send(proto string) {
+	c.enqueue([]byte(proto))
+}
+
+func (c *client) sendErr(reason string) {
+	c.send("-ERR '" + reason + "'\r\n")
+}
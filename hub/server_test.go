@@ -0,0 +1,312 @@
+package hub
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func startHub(t *testing.T, opts Options) *Server {
+	t.Helper()
+	opts.Addr = "127.0.0.1:0"
+	srv, err := Start(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func connect(t *testing.T, url string, opts ...nats.Option) *nats.Conn {
+	t.Helper()
+	nc, err := nats.Connect(url, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+// receive returns the next message on sub, or nil if none comes soon.
+func receive(sub *nats.Subscription) *nats.Msg {
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	srv := startHub(t, Options{})
+	nc := connect(t, srv.ClientURL())
+
+	sub, err := nc.SubscribeSync("oln.tag.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Publish("oln.tag.x", []byte("hello"))
+	nc.Publish("oln.geo.x", []byte("elsewhere"))
+	if msg := receive(sub); msg == nil || string(msg.Data) != "hello" {
+		t.Fatalf("received %v, want hello", msg)
+	}
+	if msg, err := sub.NextMsg(100 * time.Millisecond); err == nil {
+		t.Errorf("received %q on a subject not subscribed to", msg.Data)
+	}
+}
+
+// TestRouteSubjects checks that a route only carries the OLN subjects.
+func TestRouteSubjects(t *testing.T) {
+	remote := startHub(t, Options{RouteToken: "secret"})
+	local := startHub(t, Options{RouteToken: "secret", Routes: []string{remote.ClientURL()}})
+
+	sub, err := connect(t, local.ClientURL()).SubscribeSync(">")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := connect(t, remote.ClientURL())
+
+	// The route subscribes in the background, so publish until it arrives
+	deadline := time.Now().Add(time.Second)
+	var msg *nats.Msg
+	for msg == nil && time.Now().Before(deadline) {
+		pub.Publish("other", []byte("not for routes"))
+		pub.Publish("oln.messages.v1", []byte("hello"))
+		msg, _ = sub.NextMsg(10 * time.Millisecond)
+	}
+	for ; msg != nil; msg, _ = sub.NextMsg(100 * time.Millisecond) {
+		if msg.Subject != "oln.messages.v1" {
+			t.Fatalf("route carried %s", msg.Subject)
+		}
+	}
+}
+
+// TestRouteToken checks that only connections presenting the route token
+// are taken for routes, and that route claims without it are refused.
+func TestRouteToken(t *testing.T) {
+	srv := startHub(t, Options{RouteToken: "secret"})
+
+	tests := []struct {
+		name    string
+		opts    []nats.Option
+		refused bool
+		route   bool
+	}{
+		{"client", nil, false, false},
+		{"route name", []nats.Option{nats.Name(routeNamePrefix + "x")}, true, false},
+		{"wrong token", []nats.Option{nats.Name(routeNamePrefix + "x"), nats.Token("guess")}, true, false},
+		{"token only", []nats.Option{nats.Token("secret")}, false, false},
+		{"route", []nats.Option{nats.Name(routeNamePrefix + "x"), nats.Token("secret")}, false, true},
+	}
+	for _, tt := range tests {
+		if tt.refused {
+			nc, err := nats.Connect(srv.ClientURL(), append(tt.opts, nats.NoReconnect())...)
+			if err == nil {
+				err = nc.Flush()
+				nc.Close()
+			}
+			if err == nil || !strings.Contains(strings.ToLower(err.Error()), "authorization violation") {
+				t.Errorf("%s: err = %v, want an authorization violation", tt.name, err)
+			}
+			continue
+		}
+		nc := connect(t, srv.ClientURL(), tt.opts...)
+		if err := nc.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		id, err := nc.GetClientID()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srv.mu.RLock()
+		var c *client
+		for cl := range srv.clients {
+			if cl.id == id {
+				c = cl
+			}
+		}
+		srv.mu.RUnlock()
+		if c == nil {
+			t.Fatalf("%s: client %d not found", tt.name, id)
+		}
+		c.mu.Lock()
+		route := c.route
+		c.mu.Unlock()
+		if route != tt.route {
+			t.Errorf("%s: route = %v, want %v", tt.name, route, tt.route)
+		}
+		nc.Close()
+	}
+}
+
+func TestRoutesNeedToken(t *testing.T) {
+	srv, err := Start(Options{Addr: "127.0.0.1:0", Routes: []string{"nats://127.0.0.1:4222"}})
+	if err == nil {
+		srv.Close()
+		t.Error("started routes without a route token")
+	}
+}
+
+// TestRouteRing checks that a message goes round a ring of hubs once:
+// every hub gets one copy and none is passed on from route to route.
+func TestRouteRing(t *testing.T) {
+	a := startHub(t, Options{Name: "a", RouteToken: "secret"})
+	b := startHub(t, Options{Name: "b", RouteToken: "secret", Routes: []string{a.ClientURL()}})
+	c := startHub(t, Options{Name: "c", RouteToken: "secret", Routes: []string{b.ClientURL()}})
+	// c did not exist when a started, so close the ring by hand
+	r, err := a.dialRoute(c.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.mu.Lock()
+	a.routes = append(a.routes, r)
+	a.mu.Unlock()
+
+	var subs []*nats.Subscription
+	for _, srv := range []*Server{a, b, c} {
+		sub, err := connect(t, srv.ClientURL()).SubscribeSync("oln.messages.v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+	pub := connect(t, a.ClientURL())
+
+	// Routes subscribe in the background, so wait for every hub to see a
+	// probe before counting
+	for i, sub := range subs {
+		deadline := time.Now().Add(2 * time.Second)
+		var msg *nats.Msg
+		for msg == nil && time.Now().Before(deadline) {
+			pub.Publish("oln.messages.v1", []byte("probe"))
+			msg, _ = sub.NextMsg(10 * time.Millisecond)
+		}
+		if msg == nil {
+			t.Fatalf("hub %d never received a probe", i)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	for _, sub := range subs {
+		for _, err := sub.NextMsg(time.Millisecond); err == nil; _, err = sub.NextMsg(time.Millisecond) {
+		}
+	}
+
+	pub.Publish("oln.messages.v1", []byte("hello"))
+	time.Sleep(200 * time.Millisecond)
+	for i, sub := range subs {
+		n, _, err := sub.Pending()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("hub %d received %d copies, want 1", i, n)
+		}
+	}
+}
+
+// TestSlowConsumer checks that a subscriber that doesn't read neither
+// stalls publishers nor stays connected.
+func TestSlowConsumer(t *testing.T) {
+	srv := startHub(t, Options{})
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("CONNECT {}\r\nSUB oln.> 1\r\nPING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	nc := connect(t, srv.ClientURL())
+	// Make sure the SUB is handled before publishing
+	deadline := time.Now().Add(time.Second)
+	for srv.NumClients() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	payload := []byte(strings.Repeat("x", 4096))
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 2*maxPending; i++ {
+			if err := nc.Publish("oln.messages.v1", payload); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nc.Flush()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("publisher stalled by a slow consumer")
+	}
+
+	deadline = time.Now().Add(time.Second)
+	for srv.NumClients() > 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := srv.NumClients(); n != 1 {
+		t.Errorf("%d clients, want the slow consumer disconnected", n)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "oln-hub-test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	srv := startHub(t, Options{
+		TLS: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+	})
+	if !strings.HasPrefix(srv.ClientURL(), "tls://") {
+		t.Errorf("ClientURL() = %s, want a tls:// URL", srv.ClientURL())
+	}
+
+	if nc, err := nats.Connect(srv.ClientURL()); err == nil {
+		nc.Close()
+		t.Error("connected without trusting the certificate")
+	}
+
+	nc := connect(t, srv.ClientURL(), nats.Secure(&tls.Config{RootCAs: roots}))
+	sub, err := nc.SubscribeSync("oln.messages.v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Publish("oln.messages.v1", []byte("hello"))
+	if msg := receive(sub); msg == nil || string(msg.Data) != "hello" {
+		t.Fatalf("received %v over TLS, want hello", msg)
+	}
+}
@@ -0,0 +1,234 @@
+// Package index keeps a local inverted index of OLN documents: tags,
+// plustags, mentions, key entries, origins and links, each pointing at
+// message hashes or at links where more messages can be found.
+package index
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/location"
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/parser"
+	"github.com/lapingvino/eolnpoc/seal"
+)
+
+// Limits on what Merge takes from the index of a single document, and on
+// the references merged from other documents altogether
+const (
+	MaxMergeKeys = 100
+	MaxMergeRefs = 50 // Per key
+	MaxMerged    = 100000
+)
+
+// Index maps keys to references: message hashes or links. References of
+// our own messages stay until forgotten; those merged from the documents
+// of others expire, see Expire. It is safe for concurrent use.
+type Index struct {
+	mu     sync.RWMutex
+	refs   map[string]map[string]time.Time // Zero time for our own references
+	merged int                             // Number of merged references
+}
+
+// New returns an empty index.
+func New() *Index {
+	return &Index{refs: make(map[string]map[string]time.Time)}
+}
+
+// IsLink reports whether ref points at a document instead of a message.
+func IsLink(ref string) bool {
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") ||
+		strings.HasPrefix(ref, "/ipfs/") || strings.HasPrefix(ref, "/ipns/")
+}
+
+// NormalizeKey returns the form under which key is stored: hashtags are
+// case-insensitive and plustags are upper case. Other keys, like public
+// keys and links, are kept as they are.
+func NormalizeKey(key string) string {
+	key = strings.TrimSpace(key)
+	if strings.HasPrefix(key, "#") {
+		return strings.ToLower(key)
+	}
+	if upper := strings.ToUpper(key); location.ValidatePluscode(upper) {
+		return upper
+	}
+	return key
+}
+
+// Add records refs under key. They stay until forgotten.
+func (ix *Index) Add(key string, refs ...string) {
+	ix.add(key, refs, time.Time{})
+}
+
+// add records refs under key, as merged at the given time or, for a zero
+// time, as our own.
+func (ix *Index) add(key string, refs []string, merged time.Time) {
+	key = NormalizeKey(key)
+	if key == "" {
+		return
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	set := ix.refs[key]
+	if set == nil {
+		set = make(map[string]time.Time)
+		ix.refs[key] = set
+	}
+	for _, ref := range refs {
+		if ref == "" || ref == key {
+			continue
+		}
+		old, exists := set[ref]
+		switch {
+		case merged.IsZero():
+			if exists && !old.IsZero() {
+				ix.merged--
+			}
+			set[ref] = merged
+		case !exists:
+			if ix.merged >= MaxMerged {
+				continue
+			}
+			ix.merged++
+			set[ref] = merged
+		case !old.IsZero():
+			set[ref] = merged
+		}
+	}
+	if len(set) == 0 {
+		delete(ix.refs, key)
+	}
+}
+
+// Merge adds the index of a received document. Only links and the hashes
+// of messages the document carries, and which match them, are taken, at
+// most MaxMergeRefs for each of MaxMergeKeys keys. If the document names
+// the server it came from, its messages are also recorded under that link.
+// Merged references expire unless merged again, see Expire.
+func (ix *Index) Merge(format *olnjson.Format) {
+	now := time.Now()
+
+	verified := make(map[string]bool, len(format.Messages))
+	for hash, msg := range format.Messages {
+		verified[hash] = multihash.Verify(hash, msg) == nil
+	}
+
+	keys := 0
+	for key, refs := range format.Index {
+		if keys >= MaxMergeKeys {
+			break
+		}
+		var valid []string
+		for _, ref := range refs {
+			if len(valid) >= MaxMergeRefs {
+				break
+			}
+			if verified[ref] || IsLink(ref) {
+				valid = append(valid, ref)
+			}
+		}
+		if len(valid) > 0 {
+			ix.add(key, valid, now)
+			keys++
+		}
+	}
+
+	if IsLink(format.Server.Link) {
+		var hashes []string
+		for hash, ok := range verified {
+			if ok {
+				hashes = append(hashes, hash)
+			}
+		}
+		ix.add(format.Server.Link, hashes, now)
+	}
+}
+
+// AddMessage records hash under the tags and origin of msg and under every
+// entity in its text: mentions, links and key entries as written, plustags
+// at every level. Encrypted text is not parsed, so private locations never
+// end up in the index.
+func (ix *Index) AddMessage(hash string, msg olnjson.Message) {
+	for _, tag := range msg.Tags {
+		ix.Add(tag, hash)
+	}
+	if msg.Origin.PubKey != "" {
+		ix.Add(msg.Origin.PubKey, hash)
+	}
+	if seal.IsEncrypted(msg.Raw) {
+		return
+	}
+	for _, e := range parser.Parse(msg.Raw) {
+		if e.Kind != parser.Plustag {
+			ix.Add(e.Tag(), hash)
+			continue
+		}
+		for _, parent := range location.GetParentPlustags(e.Value) {
+			ix.Add(parent, hash)
+		}
+	}
+}
+
+// Lookup returns the sorted references stored under key.
+func (ix *Index) Lookup(key string) []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	set := ix.refs[NormalizeKey(key)]
+	result := make([]string, 0, len(set))
+	for ref := range set {
+		result = append(result, ref)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Keys returns the number of keys in the index.
+func (ix *Index) Keys() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.refs)
+}
+
+// Forget removes ref from every key, dropping keys left empty. Use it when
+// a message expires or a link turns out to be dead.
+func (ix *Index) Forget(ref string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for key, set := range ix.refs {
+		if merged, ok := set[ref]; ok {
+			if !merged.IsZero() {
+				ix.merged--
+			}
+			delete(set, ref)
+		}
+		if len(set) == 0 {
+			delete(ix.refs, key)
+		}
+	}
+}
+
+// Expire removes the merged references that were last merged before the
+// given time. Our own references are kept.
+func (ix *Index) Expire(before time.Time) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for key, set := range ix.refs {
+		for ref, merged := range set {
+			if !merged.IsZero() && merged.Before(before) {
+				delete(set, ref)
+				ix.merged--
+			}
+		}
+		if len(set) == 0 {
+			delete(ix.refs, key)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package index
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+func message(t *testing.T, raw string) (string, olnjson.Message) {
+	t.Helper()
+	msg := olnjson.Message{Raw: raw, Timestamp: olnjson.Now(), TTL: 7}
+	hash, err := multihash.Sum(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash, msg
+}
+
+func TestAddMessage(t *testing.T) {
+	hash, msg := message(t, "Hello #OLN @alice at 6FG22222+22 see https://example.com/x key:value")
+	msg.Origin.PubKey = "O2onvM62pC1io6jQKm8Nc2UyFXcd4kOmOsBIoYtZ2ik="
+
+	ix := New()
+	ix.AddMessage(hash, msg)
+	for _, key := range []string{"#oln", "#OLN", "@alice", "6FG22222+22", "6FG22200+", "6F000000+", "https://example.com/x", "key:value", msg.Origin.PubKey} {
+		if refs := ix.Lookup(key); !reflect.DeepEqual(refs, []string{hash}) {
+			t.Errorf("Lookup(%q) = %v", key, refs)
+		}
+	}
+
+	ix.Forget(hash)
+	if ix.Keys() != 0 {
+		t.Errorf("%d keys left after Forget", ix.Keys())
+	}
+}
+
+func TestMergeVerifies(t *testing.T) {
+	hash, msg := message(t, "carried")
+	other, _ := message(t, "not carried")
+	forged, forgedMsg := message(t, "forged")
+	forgedMsg.Raw = "changed"
+
+	ix := New()
+	ix.Merge(&olnjson.Format{
+		Server:   olnjson.ServerInfo{Link: "https://example.com/oln.json"},
+		Messages: map[string]olnjson.Message{hash: msg, forged: forgedMsg},
+		Index: map[string][]string{
+			"#oln": {hash, other, forged, "https://example.org/oln.json", "file:///etc/passwd"},
+		},
+	})
+
+	want := []string{hash, "https://example.org/oln.json"}
+	if refs := ix.Lookup("#oln"); !reflect.DeepEqual(refs, want) {
+		t.Errorf("Lookup(#oln) = %v, want %v", refs, want)
+	}
+	if refs := ix.Lookup("https://example.com/oln.json"); !reflect.DeepEqual(refs, []string{hash}) {
+		t.Errorf("server link refs = %v", refs)
+	}
+}
+
+func TestMergeLimits(t *testing.T) {
+	index := make(map[string][]string)
+	for i := 0; i < MaxMergeKeys*2; i++ {
+		var links []string
+		for j := 0; j < MaxMergeRefs*2; j++ {
+			links = append(links, fmt.Sprintf("https://example.com/%d/%d", i, j))
+		}
+		index[fmt.Sprintf("#tag%d", i)] = links
+	}
+
+	ix := New()
+	ix.Merge(&olnjson.Format{Index: index})
+	if ix.Keys() != MaxMergeKeys {
+		t.Errorf("%d keys merged, want %d", ix.Keys(), MaxMergeKeys)
+	}
+	for key := range index {
+		if refs := ix.Lookup(key); len(refs) != 0 && len(refs) != MaxMergeRefs {
+			t.Errorf("%s: %d refs merged, want %d", key, len(refs), MaxMergeRefs)
+		}
+	}
+}
+
+func TestExpire(t *testing.T) {
+	hash, msg := message(t, "ours #oln")
+
+	ix := New()
+	ix.AddMessage(hash, msg)
+	ix.Merge(&olnjson.Format{Index: map[string][]string{"#oln": {"https://example.com/oln.json"}}})
+	if refs := ix.Lookup("#oln"); len(refs) != 2 {
+		t.Fatalf("Lookup(#oln) = %v", refs)
+	}
+
+	ix.Expire(time.Now().Add(-time.Hour))
+	if refs := ix.Lookup("#oln"); len(refs) != 2 {
+		t.Errorf("fresh references expired: %v", refs)
+	}
+	ix.Expire(time.Now().Add(time.Hour))
+	if refs := ix.Lookup("#oln"); !reflect.DeepEqual(refs, []string{hash}) {
+		t.Errorf("after Expire, Lookup(#oln) = %v, want only our own", refs)
+	}
+	if ix.merged != 0 {
+		t.Errorf("%d merged references counted, want 0", ix.merged)
+	}
+}
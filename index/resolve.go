@@ -0,0 +1,124 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/feed"
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// Resolver turns index lookups into messages, fetching the documents behind
+// link references when the messages are not known locally.
+type Resolver struct {
+	Index      *Index
+	Client     *feed.Client
+	MaxFetches int // Maximum number of documents fetched per Resolve
+
+	// Local returns a message we already have, if any.
+	Local func(hash string) (olnjson.Message, bool)
+	// Fetched, if set, is called for every document fetched, so the
+	// caller can keep its messages. Documents that did not change since
+	// they were last fetched are not downloaded again, so their messages
+	// are only found through Local.
+	Fetched func(url string, format *olnjson.Format)
+}
+
+// NewResolver returns a resolver for ix with a new feed client.
+func NewResolver(ix *Index, local func(hash string) (olnjson.Message, bool)) *Resolver {
+	return &Resolver{
+		Index:      ix,
+		Client:     feed.NewClient(),
+		MaxFetches: 10,
+		Local:      local,
+	}
+}
+
+// Resolve returns the messages stored under key by hash. Links under key
+// are fetched and their indexes merged into ours, which may reveal more
+// hashes and links for the key; these are followed up to MaxFetches
+// documents. The messages fetched are not indexed as our own: that is up
+// to Fetched. Links
+// come from the documents of others, so only public addresses are fetched.
+// Links that could not be fetched are reported in the returned error, next
+// to whatever was found.
+func (r *Resolver) Resolve(ctx context.Context, key string) (map[string]olnjson.Message, error) {
+	found := make(map[string]olnjson.Message)
+	remote := make(map[string]olnjson.Message)
+	fetched := make(map[string]bool)
+	var errs []error
+
+	for {
+		var next string
+		for _, ref := range r.refs(key) {
+			if IsLink(ref) && !fetched[ref] {
+				next = ref
+				break
+			}
+		}
+		if next == "" || len(fetched) >= r.MaxFetches || ctx.Err() != nil {
+			break
+		}
+		fetched[next] = true
+
+		format, err := r.fetch(ctx, next)
+		if err != nil {
+			if !errors.Is(err, feed.ErrNotModified) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		for hash, msg := range format.Messages {
+			if multihash.Verify(hash, msg) != nil {
+				delete(format.Messages, hash)
+				continue
+			}
+			remote[hash] = msg
+		}
+		r.Index.Merge(format)
+		if r.Fetched != nil {
+			r.Fetched(next, format)
+		}
+	}
+
+	for _, ref := range r.refs(key) {
+		if IsLink(ref) {
+			continue
+		}
+		if msg, ok := r.lookupLocal(ref); ok {
+			found[ref] = msg
+		} else if msg, ok := remote[ref]; ok {
+			found[ref] = msg
+		}
+	}
+
+	return found, errors.Join(errs...)
+}
+
+// refs returns the references under key. Hashes and links also stand for
+// themselves, so they can be resolved without being indexed.
+func (r *Resolver) refs(key string) []string {
+	refs := r.Index.Lookup(key)
+	if IsLink(key) || strings.HasPrefix(key, "Qm") {
+		refs = append([]string{key}, refs...)
+	}
+	return refs
+}
+
+func (r *Resolver) fetch(ctx context.Context, link string) (*olnjson.Format, error) {
+	if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+		return nil, fmt.Errorf("cannot fetch %s: unsupported link", link)
+	}
+	return r.Client.Fetch(feed.PublicOnly(ctx), link)
+}
+
+func (r *Resolver) lookupLocal(hash string) (olnjson.Message, bool) {
+	if r.Local == nil {
+		return olnjson.Message{}, false
+	}
+	return r.Local(hash)
+}
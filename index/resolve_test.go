@@ -0,0 +1,54 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// TestResolveMerges checks that the messages of fetched documents are
+// only indexed as merged references, so they expire like the rest.
+func TestResolveMerges(t *testing.T) {
+	const link = "https://feed.example/oln.json"
+	hash, msg := message(t, "theirs #oln #other")
+	data, err := json.Marshal(olnjson.Format{
+		Messages: map[string]olnjson.Message{hash: msg},
+		Index:    map[string][]string{"#oln": {hash}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ix := New()
+	ix.Merge(&olnjson.Format{Index: map[string][]string{"#oln": {link}}})
+	r := NewResolver(ix, nil)
+	r.Client.HTTP = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(string(data))), Request: req}, nil
+	})}
+
+	found, err := r.Resolve(context.Background(), "#oln")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := found[hash]; len(found) != 1 || !ok || got.Raw != msg.Raw {
+		t.Fatalf("Resolve(#oln) = %v", found)
+	}
+	if refs := ix.Lookup("#other"); len(refs) != 0 {
+		t.Errorf("fetched message indexed under #other: %v", refs)
+	}
+
+	ix.Expire(time.Now().Add(time.Hour))
+	if ix.Keys() != 0 {
+		t.Errorf("%d keys left after Expire, want the fetched references gone", ix.Keys())
+	}
+}
@@ -0,0 +1,280 @@
+// Package keystore keeps named ed25519 identities on disk, each with the
+// display name and server name its messages are sent with. The private
+// key of an identity is encrypted with a passphrase (Argon2id and
+// XChaCha20-Poly1305), so an identity file can be backed up or moved to
+// another machine as it is.
+package keystore
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/signing"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	fileExt  = ".json"
+	saltSize = 16
+)
+
+var (
+	// ErrNotFound is returned for identities that are not in the store.
+	ErrNotFound = errors.New("identity not found")
+	// ErrExists is returned when adding an identity under a name in use.
+	ErrExists = errors.New("identity already exists")
+	// ErrPassphrase is returned when a key does not decrypt.
+	ErrPassphrase = errors.New("wrong passphrase")
+	// ErrEmptyPassphrase is returned when saving a key without passphrase.
+	ErrEmptyPassphrase = errors.New("empty passphrase")
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Identity is a stored identity. Key holds the encrypted seed of the
+// private key; use Unlock to get the key itself.
+type Identity struct {
+	Name       string `json:"name"`       // Name in the store
+	Display    string `json:"display"`    // Origin.Display of messages
+	ServerName string `json:"servername"` // Origin.ServerName of messages
+	PubKey     string `json:"pubkey"`
+	Salt       string `json:"salt"`
+	Key        string `json:"key"`
+}
+
+// Origin returns the origin messages from this identity carry.
+func (id *Identity) Origin() olnjson.Origin {
+	return olnjson.Origin{
+		Display:    id.Display,
+		PubKey:     id.PubKey,
+		ServerName: id.ServerName,
+	}
+}
+
+// Unlock decrypts the private key of the identity.
+func (id *Identity) Unlock(passphrase string) (ed25519.PrivateKey, error) {
+	salt, err := base64.URLEncoding.DecodeString(id.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %v", err)
+	}
+	sealed, err := base64.URLEncoding.DecodeString(id.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %v", err)
+	}
+
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, salt))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid key length: %d", len(sealed))
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	seed, err := aead.Open(nil, nonce, ciphertext, []byte(id.PubKey))
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid seed length: %d", len(seed))
+	}
+
+	key := ed25519.NewKeyFromSeed(seed)
+	if signing.EncodePubKey(key.Public().(ed25519.PublicKey)) != id.PubKey {
+		return nil, errors.New("key does not match public key")
+	}
+	return key, nil
+}
+
+// lock encrypts key with passphrase into the identity.
+func (id *Identity) lock(key ed25519.PrivateKey, passphrase string) error {
+	if passphrase == "" {
+		return ErrEmptyPassphrase
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, salt))
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+ed25519.SeedSize+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	id.PubKey = signing.EncodePubKey(key.Public().(ed25519.PublicKey))
+	id.Salt = base64.URLEncoding.EncodeToString(salt)
+	id.Key = base64.URLEncoding.EncodeToString(aead.Seal(nonce, nonce, key.Seed(), []byte(id.PubKey)))
+	return nil
+}
+
+func deriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, chacha20poly1305.KeySize)
+}
+
+// Parse reads an identity as written by Save or Export and checks that it
+// is complete.
+func Parse(data []byte) (*Identity, error) {
+	var id Identity
+	if err := json.Unmarshal(data, &id); err != nil {
+		return nil, fmt.Errorf("invalid identity: %v", err)
+	}
+	if _, err := signing.DecodePubKey(id.PubKey); err != nil {
+		return nil, fmt.Errorf("invalid identity: %v", err)
+	}
+	if id.Salt == "" || id.Key == "" {
+		return nil, errors.New("invalid identity: no key")
+	}
+	return &id, nil
+}
+
+// Store is a directory of identity files, one per identity.
+type Store struct {
+	Dir string
+}
+
+// DefaultDir returns where identities are kept when no store is given.
+func DefaultDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "oln", "identities"), nil
+}
+
+// Open returns the store in dir, DefaultDir if dir is empty. The directory
+// is created when the first identity is saved.
+func Open(dir string) (*Store, error) {
+	if dir == "" {
+		var err error
+		if dir, err = DefaultDir(); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{Dir: dir}, nil
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.Dir, name+fileExt)
+}
+
+// Create generates a new identity and saves it under name, encrypted with
+// passphrase.
+func (s *Store) Create(name, display, serverName, passphrase string) (*Identity, error) {
+	key, err := signing.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	return s.Add(name, display, serverName, key, passphrase)
+}
+
+// Add saves an existing key as a new identity, encrypted with passphrase,
+// which must not be empty.
+func (s *Store) Add(name, display, serverName string, key ed25519.PrivateKey, passphrase string) (*Identity, error) {
+	id := &Identity{Name: name, Display: display, ServerName: serverName}
+	if err := id.lock(key, passphrase); err != nil {
+		return nil, err
+	}
+	if err := s.Save(id); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// Save writes an identity to the store, readable only by the owner. It
+// does not overwrite identities already stored under the same name.
+func (s *Store) Save(id *Identity) error {
+	if !namePattern.MatchString(id.Name) {
+		return fmt.Errorf("invalid identity name: %q", id.Name)
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path(id.Name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrExists, id.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Get returns the identity stored under name.
+func (s *Store) Get(name string) (*Identity, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid identity name: %q", name)
+	}
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	id, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	id.Name = name
+	return id, nil
+}
+
+// Export returns the stored file of an identity. The key stays encrypted.
+func (s *Store) Export(name string) ([]byte, error) {
+	id, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// List returns the stored identities sorted by name. Files that cannot be
+// read are skipped.
+func (s *Store) List() ([]*Identity, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []*Identity
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), fileExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if id, err := s.Get(name); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Name < ids[j].Name })
+	return ids, nil
+}
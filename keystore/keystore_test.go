@@ -0,0 +1,91 @@
+package keystore
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"github.com/lapingvino/eolnpoc/signing"
+)
+
+func TestLockUnlock(t *testing.T) {
+	store := &Store{Dir: t.TempDir()}
+	id, err := store.Create("alice", "Alice", "", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stored != *id {
+		t.Errorf("stored %+v, want %+v", stored, id)
+	}
+	key, err := stored.Unlock("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub := signing.EncodePubKey(key.Public().(ed25519.PublicKey)); pub != id.PubKey {
+		t.Errorf("unlocked key %s, want %s", pub, id.PubKey)
+	}
+
+	if _, err := stored.Unlock("wrong horse"); !errors.Is(err, ErrPassphrase) {
+		t.Errorf("Unlock with the wrong passphrase: %v", err)
+	}
+	if _, err := stored.Unlock(""); !errors.Is(err, ErrPassphrase) {
+		t.Errorf("Unlock with an empty passphrase: %v", err)
+	}
+}
+
+// TestUnlockTamperedPubKey checks that an identity file whose public key
+// was swapped for another does not unlock.
+func TestUnlockTamperedPubKey(t *testing.T) {
+	store := &Store{Dir: t.TempDir()}
+	id, err := store.Create("alice", "", "", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := *id
+	tampered.PubKey = signing.EncodePubKey(other.Public().(ed25519.PublicKey))
+	if _, err := tampered.Unlock("correct horse"); err == nil {
+		t.Error("identity with a tampered public key unlocked")
+	}
+}
+
+func TestEmptyPassphrase(t *testing.T) {
+	store := &Store{Dir: t.TempDir()}
+	if _, err := store.Create("alice", "", "", ""); !errors.Is(err, ErrEmptyPassphrase) {
+		t.Errorf("Create with an empty passphrase: %v", err)
+	}
+	if _, err := store.Get("alice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("identity without passphrase saved: %v", err)
+	}
+}
+
+func TestExportParse(t *testing.T) {
+	store := &Store{Dir: t.TempDir()}
+	id, err := store.Create("alice", "Alice", "example", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := store.Export("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *parsed != *id {
+		t.Errorf("parsed %+v, want %+v", parsed, id)
+	}
+	if _, err := Parse([]byte(`{"name":"alice","pubkey":"x"}`)); err == nil {
+		t.Error("Parse accepted an identity without key")
+	}
+}
@@ -0,0 +1,74 @@
+package location
+
+import "math"
+
+const (
+	// Mean earth radius in metres
+	earthRadius = 6371000.0
+
+	// DefaultProximityRadius is the distance in metres at which two
+	// locations stop counting as near each other.
+	DefaultProximityRadius = 10000.0
+
+	// MaxProximity is the score of two overlapping locations.
+	MaxProximity = 500
+)
+
+// Haversine returns the great-circle distance in metres between two points.
+func Haversine(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lng2 - lng1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// AreaDistance returns the shortest distance in metres between two areas,
+// which is 0 if they overlap or one contains the other.
+func AreaDistance(a, b CodeArea) float64 {
+	lat1, lat2 := closest(a.LatLo, a.LatHi, b.LatLo, b.LatHi)
+	lng1, lng2 := closest(a.LngLo, a.LngHi, b.LngLo, b.LngHi)
+	return Haversine(lat1, lng1, lat2, lng2)
+}
+
+// closest returns the nearest pair of values from two intervals on one axis.
+func closest(lo1, hi1, lo2, hi2 float64) (float64, float64) {
+	switch {
+	case hi1 < lo2:
+		return hi1, lo2
+	case hi2 < lo1:
+		return lo1, hi2
+	default:
+		// Overlapping: any shared value will do
+		v := math.Max(lo1, lo2)
+		return v, v
+	}
+}
+
+// Distance returns the shortest distance in metres between the areas of
+// two full plus codes.
+func Distance(code1, code2 string) (float64, error) {
+	a, err := Decode(code1)
+	if err != nil {
+		return 0, err
+	}
+	b, err := Decode(code2)
+	if err != nil {
+		return 0, err
+	}
+	return AreaDistance(a, b), nil
+}
+
+// Proximity scores how close two plus codes are, from MaxProximity when
+// their areas touch down to 0 at radius metres apart or further.
+// Invalid codes score 0.
+func Proximity(code1, code2 string, radius float64) int {
+	d, err := Distance(code1, code2)
+	if err != nil || d >= radius {
+		return 0
+	}
+	return int(math.Round(MaxProximity * (1 - d/radius)))
+}
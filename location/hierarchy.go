@@ -0,0 +1,58 @@
+package location
+
+import (
+	"math"
+	"strings"
+)
+
+// Metres per degree of latitude
+const metresPerDegree = earthRadius * math.Pi / 180
+
+// Level is one step in the hierarchy of a plus code.
+type Level struct {
+	Code      string  // Code at this level, padded up to the separator if needed
+	Length    int     // Number of significant digits
+	Precision float64 // Approximate height of the area in metres
+}
+
+// Hierarchy walks every OLC precision level of a full code, from the code
+// itself up to its 2-digit area. Grid digits beyond the 10th are removed
+// one at a time, pair digits two at a time:
+//
+//	8FVC9G8F+6XG → 8FVC9G8F+6XG, 8FVC9G8F+6X, 8FVC9G8F+, 8FVC9G00+, 8FVC0000+, 8F000000+
+func Hierarchy(code string) ([]Level, error) {
+	area, err := Decode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	digits := strings.ToUpper(code)
+	digits = strings.ReplaceAll(digits, string(separator), "")
+	digits = strings.TrimRight(digits, string(padding))[:area.Length]
+
+	var levels []Level
+	for length := area.Length; length >= 2; {
+		levels = append(levels, Level{
+			Code:      formatCode(digits[:length]),
+			Length:    length,
+			Precision: latitudePrecision(length) * metresPerDegree,
+		})
+
+		if length > pairCodeLength {
+			length--
+		} else {
+			// Pair codes have even lengths
+			length = (length - 1) / 2 * 2
+		}
+	}
+	return levels, nil
+}
+
+// formatCode turns significant digits into a code, adding the separator
+// and padding.
+func formatCode(digits string) string {
+	if len(digits) < separatorPos {
+		return digits + strings.Repeat(string(padding), separatorPos-len(digits)) + string(separator)
+	}
+	return digits[:separatorPos] + string(separator) + digits[separatorPos:]
+}
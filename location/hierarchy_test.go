@@ -0,0 +1,88 @@
+package location
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHierarchy(t *testing.T) {
+	// Height in degrees of the areas of each code length
+	degrees := map[int]float64{
+		2:  20,
+		4:  1,
+		6:  0.05,
+		8:  0.0025,
+		10: 0.000125,
+		11: 0.000025,
+		12: 0.000005,
+	}
+
+	tests := []struct {
+		code  string
+		codes []string
+	}{
+		{"6FG22222+", []string{"6FG22222+", "6FG22200+", "6FG20000+", "6F000000+"}},
+		{"6FG22200+", []string{"6FG22200+", "6FG20000+", "6F000000+"}},
+		{"6F000000+", []string{"6F000000+"}},
+		{"6FG22222+22", []string{"6FG22222+22", "6FG22222+", "6FG22200+", "6FG20000+", "6F000000+"}},
+		{"8fvc9g8f+6x", []string{"8FVC9G8F+6X", "8FVC9G8F+", "8FVC9G00+", "8FVC0000+", "8F000000+"}},
+		{"8FVC9G8F+6XG", []string{"8FVC9G8F+6XG", "8FVC9G8F+6X", "8FVC9G8F+", "8FVC9G00+", "8FVC0000+", "8F000000+"}},
+		{"8FVC9G8F+6XGH", []string{"8FVC9G8F+6XGH", "8FVC9G8F+6XG", "8FVC9G8F+6X", "8FVC9G8F+", "8FVC9G00+", "8FVC0000+", "8F000000+"}},
+	}
+	for _, tt := range tests {
+		levels, err := Hierarchy(tt.code)
+		if err != nil {
+			t.Errorf("Hierarchy(%q): %v", tt.code, err)
+			continue
+		}
+		if len(levels) != len(tt.codes) {
+			t.Errorf("Hierarchy(%q) has %d levels, want %d: %v", tt.code, len(levels), len(tt.codes), levels)
+			continue
+		}
+		for i, level := range levels {
+			if level.Code != tt.codes[i] {
+				t.Errorf("Hierarchy(%q)[%d].Code = %q, want %q", tt.code, i, level.Code, tt.codes[i])
+			}
+
+			// Drop the separator and padding to count the digits
+			length := 0
+			for _, c := range level.Code {
+				if c != separator && c != padding {
+					length++
+				}
+			}
+			if level.Length != length {
+				t.Errorf("Hierarchy(%q)[%d].Length = %d, want %d", tt.code, i, level.Length, length)
+			}
+
+			want := degrees[length] * metresPerDegree
+			if want == 0 || math.Abs(level.Precision-want) > want*1e-9 {
+				t.Errorf("Hierarchy(%q)[%d].Precision = %f, want %f", tt.code, i, level.Precision, want)
+			}
+		}
+	}
+}
+
+func TestHierarchyPrecision(t *testing.T) {
+	levels, err := Hierarchy("6FG22222+22")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// About 14 m, 280 m, 5.5 km, 111 km and 2200 km
+	metres := []float64{14, 278, 5560, 111195, 2223900}
+	for i, level := range levels {
+		want := metres[i]
+		if math.Abs(level.Precision-want) > want*0.01 {
+			t.Errorf("%s: precision %.0f m, want about %.0f m", level.Code, level.Precision, want)
+		}
+	}
+}
+
+func TestHierarchyInvalid(t *testing.T) {
+	for _, code := range []string{"", "6FG2", "9VXG+2C", "6FG22222+2", "6FG2200+", "6FG22222+22I", "abc"} {
+		if levels, err := Hierarchy(code); err == nil {
+			t.Errorf("Hierarchy(%q) = %v, want an error", code, levels)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package location
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Constants of the Open Location Code specification
+const (
+	separator      = '+'
+	separatorPos   = 8
+	padding        = '0'
+	encodingBase   = 20
+	pairCodeLength = 10
+	gridCodeLength = 5
+	gridColumns    = 4
+	gridRows       = 5
+	maxCodeLength  = 15
+	latMax         = 90
+	lngMax         = 180
+
+	// Place value of the first pair digit, and the precision of the last
+	// pair digit, as integers
+	pairFirstPlaceValue = 160000 // encodingBase^4
+	pairPrecision       = 8000   // encodingBase^3
+
+	// Place values of the first grid digit
+	gridLatFirstPlaceValue = 625 // gridRows^(gridCodeLength-1)
+	gridLngFirstPlaceValue = 256 // gridColumns^(gridCodeLength-1)
+
+	// Multipliers that turn degrees into integers at full precision
+	finalLatPrecision = pairPrecision * 3125 // gridRows^gridCodeLength
+	finalLngPrecision = pairPrecision * 1024 // gridColumns^gridCodeLength
+)
+
+// CodeArea is the rectangle a plus code refers to. The low edges belong to
+// the area, the high edges to its neighbours.
+type CodeArea struct {
+	LatLo, LngLo float64
+	LatHi, LngHi float64
+	Length       int // Number of significant digits in the code
+}
+
+// Center returns the coordinates of the middle of the area.
+func (a CodeArea) Center() (lat, lng float64) {
+	lat = math.Min((a.LatLo+a.LatHi)/2, latMax)
+	lng = math.Min((a.LngLo+a.LngHi)/2, lngMax)
+	return lat, lng
+}
+
+// Contains reports whether the coordinates lie inside the area.
+func (a CodeArea) Contains(lat, lng float64) bool {
+	return lat >= a.LatLo && lat < a.LatHi && lng >= a.LngLo && lng < a.LngHi
+}
+
+// CheckValid returns an error describing why code is not a valid plus code,
+// or nil if it is. Both full and short codes are accepted.
+func CheckValid(code string) error {
+	code = strings.ToUpper(code)
+	if len(code) <= 1 {
+		return errors.New("code too short")
+	}
+
+	sep := strings.IndexByte(code, separator)
+	if sep < 0 {
+		return errors.New("missing separator")
+	}
+	if strings.LastIndexByte(code, separator) != sep {
+		return errors.New("more than one separator")
+	}
+	if sep > separatorPos || sep%2 == 1 {
+		return errors.New("separator in wrong position")
+	}
+	if len(code)-sep-1 == 1 {
+		return errors.New("only one digit after separator")
+	}
+
+	if pad := strings.IndexByte(code, padding); pad >= 0 {
+		if sep < separatorPos {
+			return errors.New("short codes cannot be padded")
+		}
+		if pad == 0 || pad%2 == 1 {
+			return errors.New("padding in wrong position")
+		}
+		if strings.Trim(code[pad:sep], string(padding)) != "" {
+			return errors.New("padding must be contiguous")
+		}
+		if len(code) > sep+1 {
+			return errors.New("padded codes cannot have digits after the separator")
+		}
+	}
+
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		if c == separator || c == padding {
+			continue
+		}
+		if strings.IndexByte(base20, c) < 0 {
+			return fmt.Errorf("invalid character %q", c)
+		}
+	}
+	return nil
+}
+
+// IsFull reports whether code is a valid full (not shortened) plus code
+// that refers to an actual location.
+func IsFull(code string) bool {
+	if CheckValid(code) != nil {
+		return false
+	}
+	code = strings.ToUpper(code)
+	if strings.IndexByte(code, separator) != separatorPos {
+		return false
+	}
+
+	// The first pair must be within latitude 90 and longitude 180
+	if strings.IndexByte(base20, code[0])*encodingBase >= latMax*2 {
+		return false
+	}
+	if strings.IndexByte(base20, code[1])*encodingBase >= lngMax*2 {
+		return false
+	}
+	return true
+}
+
+// Encode returns the plus code of the given length for a location. Lengths
+// below 10 must be even and are rounded up if they are not; the result is
+// padded with 0 up to the separator. Lengths are limited to 2-15.
+func Encode(lat, lng float64, length int) string {
+	if length < 2 {
+		length = 2
+	}
+	if length < pairCodeLength && length%2 == 1 {
+		length++
+	}
+	if length > maxCodeLength {
+		length = maxCodeLength
+	}
+
+	lat = clipLatitude(lat)
+	lng = normalizeLongitude(lng)
+
+	// Latitude 90 has to be nudged down so the code can be decoded again
+	if lat == latMax {
+		lat -= latitudePrecision(length)
+	}
+
+	// Work with integers at full precision to avoid rounding errors
+	latVal := int64(math.Floor(math.Round((lat+latMax)*finalLatPrecision*1e6) / 1e6))
+	lngVal := int64(math.Floor(math.Round((lng+lngMax)*finalLngPrecision*1e6) / 1e6))
+
+	// Digits are produced least significant first and reversed at the end
+	code := make([]byte, 0, maxCodeLength+1)
+	if length > pairCodeLength {
+		for i := 0; i < gridCodeLength; i++ {
+			latDigit := latVal % gridRows
+			lngDigit := lngVal % gridColumns
+			code = append(code, base20[latDigit*gridColumns+lngDigit])
+			latVal /= gridRows
+			lngVal /= gridColumns
+		}
+	} else {
+		latVal /= finalLatPrecision / pairPrecision
+		lngVal /= finalLngPrecision / pairPrecision
+	}
+
+	for i := 0; i < pairCodeLength/2; i++ {
+		code = append(code, base20[lngVal%encodingBase])
+		code = append(code, base20[latVal%encodingBase])
+		latVal /= encodingBase
+		lngVal /= encodingBase
+		if i == 0 {
+			code = append(code, separator)
+		}
+	}
+
+	for i, j := 0, len(code)-1; i < j; i, j = i+1, j-1 {
+		code[i], code[j] = code[j], code[i]
+	}
+
+	if length >= separatorPos {
+		return string(code[:length+1])
+	}
+	return string(code[:length]) + strings.Repeat(string(padding), separatorPos-length) + string(separator)
+}
+
+// Decode returns the area a full plus code refers to.
+func Decode(code string) (CodeArea, error) {
+	if !IsFull(code) {
+		return CodeArea{}, fmt.Errorf("not a valid full plus code: %s", code)
+	}
+
+	// Only the significant digits matter
+	digits := strings.ToUpper(code)
+	digits = strings.ReplaceAll(digits, string(separator), "")
+	digits = strings.TrimRight(digits, string(padding))
+	if len(digits) > maxCodeLength {
+		digits = digits[:maxCodeLength]
+	}
+
+	// Compute the low corner as integers and convert to degrees at the end
+	normalLat := int64(-latMax * pairPrecision)
+	normalLng := int64(-lngMax * pairPrecision)
+	var extraLat, extraLng int64
+
+	pairDigits := min(len(digits), pairCodeLength)
+	placeValue := int64(pairFirstPlaceValue)
+	for i := 0; i < pairDigits; i += 2 {
+		normalLat += int64(strings.IndexByte(base20, digits[i])) * placeValue
+		normalLng += int64(strings.IndexByte(base20, digits[i+1])) * placeValue
+		if i < pairDigits-2 {
+			placeValue /= encodingBase
+		}
+	}
+	latPrec := float64(placeValue) / pairPrecision
+	lngPrec := float64(placeValue) / pairPrecision
+
+	if len(digits) > pairCodeLength {
+		rowValue := int64(gridLatFirstPlaceValue)
+		colValue := int64(gridLngFirstPlaceValue)
+		for i := pairCodeLength; i < len(digits); i++ {
+			value := int64(strings.IndexByte(base20, digits[i]))
+			extraLat += value / gridColumns * rowValue
+			extraLng += value % gridColumns * colValue
+			if i < len(digits)-1 {
+				rowValue /= gridRows
+				colValue /= gridColumns
+			}
+		}
+		latPrec = float64(rowValue) / finalLatPrecision
+		lngPrec = float64(colValue) / finalLngPrecision
+	}
+
+	lat := float64(normalLat)/pairPrecision + float64(extraLat)/finalLatPrecision
+	lng := float64(normalLng)/pairPrecision + float64(extraLng)/finalLngPrecision
+	return CodeArea{
+		LatLo:  lat,
+		LngLo:  lng,
+		LatHi:  lat + latPrec,
+		LngHi:  lng + lngPrec,
+		Length: len(digits),
+	}, nil
+}
+
+// latitudePrecision returns the height in degrees of a code of the given length.
+func latitudePrecision(length int) float64 {
+	if length <= pairCodeLength {
+		return math.Pow(encodingBase, float64(length/-2+2))
+	}
+	return math.Pow(encodingBase, -3) / math.Pow(gridRows, float64(length-pairCodeLength))
+}
+
+func clipLatitude(lat float64) float64 {
+	return math.Min(latMax, math.Max(-latMax, lat))
+}
+
+func normalizeLongitude(lng float64) float64 {
+	for lng < -lngMax {
+		lng += 2 * lngMax
+	}
+	for lng >= lngMax {
+		lng -= 2 * lngMax
+	}
+	return lng
+}
+
+// Height in degrees of the area of each pair of digits
+var pairResolutions = []float64{20.0, 1.0, .05, .0025, .000125}
+
+// IsShort reports whether code is a valid short code: a full code with
+// leading digits removed, which only identifies a location together with
+// a nearby reference.
+func IsShort(code string) bool {
+	if CheckValid(code) != nil {
+		return false
+	}
+	sep := strings.IndexByte(code, separator)
+	return sep >= 0 && sep < separatorPos
+}
+
+// RecoverNearest turns a short code into the full code nearest to the
+// reference location. Full codes are returned unchanged.
+func RecoverNearest(code string, lat, lng float64) (string, error) {
+	if !IsShort(code) {
+		if IsFull(code) {
+			return strings.ToUpper(code), nil
+		}
+		return "", fmt.Errorf("not a valid short plus code: %s", code)
+	}
+
+	lat = clipLatitude(lat)
+	lng = normalizeLongitude(lng)
+	code = strings.ToUpper(code)
+
+	// Take the missing leading digits from the reference location
+	padLength := separatorPos - strings.IndexByte(code, separator)
+	resolution := math.Pow(encodingBase, float64(2-padLength/2))
+	halfResolution := resolution / 2
+
+	area, err := Decode(Encode(lat, lng, pairCodeLength)[:padLength] + code)
+	if err != nil {
+		return "", err
+	}
+
+	// If the result is more than half a cell away from the reference, the
+	// neighbouring cell is closer
+	centerLat, centerLng := area.Center()
+	if lat+halfResolution < centerLat && centerLat-resolution >= -latMax {
+		centerLat -= resolution
+	} else if lat-halfResolution > centerLat && centerLat+resolution <= latMax {
+		centerLat += resolution
+	}
+	if lng+halfResolution < centerLng {
+		centerLng -= resolution
+	} else if lng-halfResolution > centerLng {
+		centerLng += resolution
+	}
+
+	return Encode(centerLat, centerLng, area.Length), nil
+}
+
+// Shorten removes as many leading digits from a full code as can be
+// recovered with RecoverNearest from the given reference location.
+func Shorten(code string, lat, lng float64) (string, error) {
+	if !IsFull(code) {
+		return "", fmt.Errorf("not a valid full plus code: %s", code)
+	}
+	if strings.IndexByte(code, padding) >= 0 {
+		return "", fmt.Errorf("padded codes cannot be shortened: %s", code)
+	}
+
+	code = strings.ToUpper(code)
+	area, err := Decode(code)
+	if err != nil {
+		return "", err
+	}
+	if area.Length < 6 {
+		return "", fmt.Errorf("code too short to shorten: %s", code)
+	}
+
+	centerLat, centerLng := area.Center()
+	distance := math.Max(math.Abs(centerLat-clipLatitude(lat)), math.Abs(centerLng-normalizeLongitude(lng)))
+
+	// Allow some safety margin: 0.3 instead of half the resolution
+	for i := len(pairResolutions) - 2; i >= 1; i-- {
+		if distance < pairResolutions[i]*0.3 {
+			return code[(i+1)*2:], nil
+		}
+	}
+	return code, nil
+}
@@ -8,84 +8,79 @@ import (
 // Base20 charset used in pluscodes (OLC/Plus Codes)
 const base20 = "23456789CFGHJMPQRVWX"
 
-// ValidatePluscode checks if a string is a valid pluscode format
-func ValidatePluscode(code string) bool {
-	// Remove spaces if any
-	code = strings.TrimSpace(code)
-
-	// Must contain a plus sign
-	if !strings.Contains(code, "+") {
-		return false
-	}
-
-	parts := strings.Split(code, "+")
-	if len(parts) != 2 {
-		return false
-	}
-
-	prefix := parts[0]
-	suffix := parts[1]
-
-	// Prefix should be 8 base20 chars
-	if len(prefix) != 8 {
-		return false
-	}
-
-	// Suffix should be 0-2 base20 chars
-	if len(suffix) > 2 {
-		return false
-	}
-
-	// All chars should be base20
-	for _, c := range prefix {
-		if !strings.ContainsRune(base20, c) {
-			return false
-		}
-	}
-
-	for _, c := range suffix {
-		if !strings.ContainsRune(base20, c) {
-			return false
-		}
-	}
+// Character class of the base20 digits, for building patterns
+const base20Class = `[23456789CFGHJMPQRVWX]`
+
+var (
+	// Full codes: 8 digits with 0 or 2-7 after the separator, or fewer
+	// digits padded with 0 up to the separator
+	fullCodePattern = regexp.MustCompile(base20Class + `{8}\+(?:` + base20Class + `{2,7})?|` +
+		base20Class + `{6}00\+|` + base20Class + `{4}0000\+|` + base20Class + `{2}000000\+`)
+
+	// Short codes: 2, 4 or 6 leading digits removed
+	shortCodePattern = regexp.MustCompile(`(?:` + base20Class + `{6}|` + base20Class + `{4}|` + base20Class + `{2})\+` +
+		base20Class + `{2,7}`)
+
+	// #geo hashtags with an 8-digit or padded prefix, in either case
+	geoHashtagPattern = regexp.MustCompile(`#geo((?i)` + base20Class + `{8}|` + base20Class + `{6}00|` +
+		base20Class + `{4}0000|` + base20Class + `{2}000000)`)
+)
 
-	return true
+// ValidatePluscode checks if a string is a valid full pluscode, including
+// padded codes like 6FG22200+ and precise codes with up to 15 digits
+func ValidatePluscode(code string) bool {
+	return IsFull(strings.TrimSpace(code))
 }
 
-// ExtractPluscodes finds all pluscodes in text
+// ExtractPluscodes finds all full pluscodes in text, including padded and
+// precise ones
 func ExtractPluscodes(text string) []string {
-	// Regex for pluscode: 8 base20 chars + '+' + 0-2 base20 chars
-	// We use a simplified pattern that matches the format
-	re := regexp.MustCompile(`[23456789CFGHJMPQRVWX]{8}\+[23456789CFGHJMPQRVWX]{0,2}`)
-	matches := re.FindAllString(text, -1)
+	return findCodes(fullCodePattern, text, IsFull)
+}
+
+// ExtractShortCodes finds all short pluscodes (e.g. 9VXG+2C) in text. They
+// need a reference location to be turned into full codes, see RecoverNearest.
+func ExtractShortCodes(text string) []string {
+	return findCodes(shortCodePattern, text, IsShort)
+}
 
-	// Deduplicate
+// findCodes returns the deduplicated matches of re in text that stand on
+// their own (not part of a longer word) and pass valid.
+func findCodes(re *regexp.Regexp, text string, valid func(string) bool) []string {
 	seen := make(map[string]bool)
 	var result []string
-	for _, m := range matches {
-		if !seen[m] && ValidatePluscode(m) {
+	for _, loc := range re.FindAllStringIndex(text, -1) {
+		if loc[0] > 0 && isWordByte(text[loc[0]-1]) {
+			continue
+		}
+		if loc[1] < len(text) && isWordByte(text[loc[1]]) {
+			continue
+		}
+		m := text[loc[0]:loc[1]]
+		if !seen[m] && valid(m) {
 			seen[m] = true
 			result = append(result, m)
 		}
 	}
-
 	return result
 }
 
+func isWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '_' || c == '+'
+}
+
 // ExtractGeoHashtags converts #geoXXXXXXXX hashtags to pluscodes
-// e.g., #geo6FG22222 → 6FG22222+
+// e.g., #geo6FG22222 → 6FG22222+, #geo6fg22200 → 6FG22200+
 func ExtractGeoHashtags(text string) []string {
-	// Look for #geo followed by 8 base20 chars
-	re := regexp.MustCompile(`#geo([23456789CFGHJMPQRVWX]{8})`)
-	matches := re.FindAllStringSubmatch(text, -1)
+	matches := geoHashtagPattern.FindAllStringSubmatch(text, -1)
 
 	var result []string
 	seen := make(map[string]bool)
 
 	for _, match := range matches {
 		if len(match) > 1 {
-			code := match[1] + "+"
-			if !seen[code] {
+			code := strings.ToUpper(match[1]) + "+"
+			if !seen[code] && IsFull(code) {
 				seen[code] = true
 				result = append(result, code)
 			}
@@ -95,128 +90,70 @@ func ExtractGeoHashtags(text string) []string {
 	return result
 }
 
-// PadPluscodePair pads a 2-char pair with 00
-// e.g., "22" → "00"
-func PadPluscodePair(pair string) string {
-	if len(pair) < 2 {
-		return "00"
-	}
-	return "00"
-}
-
-// GetParentPlustags generates the hierarchy of pluscodes
-// e.g., 6FG22222+22 → [6FG22222+22, 6FG22222+, 6FG22200+, 6FG20000+, 6FG00000+]
-func GetParentPlustags(code string) []string {
-	if !ValidatePluscode(code) {
-		return []string{}
+// RecoverShortCodes finds the short pluscodes in text and recovers them to
+// full codes using the centre of the reference pluscode, so "9VXG+2C" in a
+// message becomes a full code when the reader's location is nearby.
+func RecoverShortCodes(text, reference string) []string {
+	area, err := Decode(reference)
+	if err != nil {
+		return nil
 	}
-
-	parts := strings.Split(code, "+")
-	prefix := parts[0]
-	suffix := parts[1]
+	lat, lng := area.Center()
 
 	var result []string
-
-	// Always include the original
-	result = append(result, code)
-
-	// If suffix is not empty, add version without suffix
-	if suffix != "" {
-		result = append(result, prefix+"+")
-	}
-
-	// Generate padded versions by progressively removing precision
-	// from the suffix, then from the prefix
-
-	// Start from the full suffix and work backwards
-	if len(suffix) == 2 {
-		// Add version with first char of suffix only
-		result = append(result, prefix+"+"+string(suffix[0]))
-	}
-
-	// Now pad the prefix progressively
-	// E.g., 6FG22222 → 6FG22200 → 6FG20000 → 6F000000 → 60000000 (if we go that far)
-
-	// Pad last char of prefix (2 chars = 1 pair)
-	if len(prefix) >= 2 {
-		padded := prefix[:len(prefix)-2] + "00"
-		result = append(result, padded+"+")
+	for _, short := range ExtractShortCodes(text) {
+		if code, err := RecoverNearest(short, lat, lng); err == nil {
+			result = append(result, code)
+		}
 	}
+	return result
+}
 
-	// Pad last 4 chars of prefix (2 pairs)
-	if len(prefix) >= 4 {
-		padded := prefix[:len(prefix)-4] + "0000"
-		result = append(result, padded+"+")
+// GetParentPlustags generates the hierarchy of pluscodes, from the code
+// itself up to its 2-digit area
+// e.g., 6FG22222+22 → [6FG22222+22, 6FG22222+, 6FG22200+, 6FG20000+, 6F000000+]
+func GetParentPlustags(code string) []string {
+	levels, err := Hierarchy(code)
+	if err != nil {
+		return []string{}
 	}
 
-	// Pad last 6 chars of prefix (3 pairs)
-	if len(prefix) >= 6 {
-		padded := prefix[:len(prefix)-6] + "000000"
-		result = append(result, padded+"+")
+	result := make([]string, len(levels))
+	for i, level := range levels {
+		result[i] = level.Code
 	}
-
-	// Pad all 8 chars (4 pairs)
-	result = append(result, "00000000+")
-
 	return result
 }
 
 // CalculateProximity calculates a proximity score between two pluscodes
-// Score is based on how many characters match from the start
-// Returns 0-500: (matching_chars / 8) * 500
+// based on the distance between their areas, using DefaultProximityRadius.
+// Returns 0-500, see Proximity.
 func CalculateProximity(location1, location2 string) int {
-	if !ValidatePluscode(location1) || !ValidatePluscode(location2) {
-		return 0
-	}
-
-	// Extract just the prefix (before the +)
-	prefix1 := strings.Split(location1, "+")[0]
-	prefix2 := strings.Split(location2, "+")[0]
-
-	// Count matching characters from the start
-	matchingChars := 0
-	maxLen := 8
-
-	for i := 0; i < maxLen; i++ {
-		if i < len(prefix1) && i < len(prefix2) && prefix1[i] == prefix2[i] {
-			matchingChars++
-		} else {
-			break
-		}
-	}
-
-	// Score: (matching_chars / 8) * 500
-	// Max 500 for exact match, min 0 for no match
-	return (matchingChars * 500) / 8
+	return Proximity(location1, location2, DefaultProximityRadius)
 }
 
-// IsLocationMatch checks if a message location matches the filter location
-// Returns true if the locations are close enough
-// For now, we consider it a match if they share at least the first 6 chars (within city level)
+// IsLocationMatch reports whether the area of one location contains the
+// other, so 6F000000+ matches 6FG22222+ and the other way round.
 func IsLocationMatch(messageLocation, filterLocation string) bool {
-	if !ValidatePluscode(messageLocation) || !ValidatePluscode(filterLocation) {
+	message, err := Hierarchy(messageLocation)
+	if err != nil {
 		return false
 	}
-
-	prefix1 := strings.Split(messageLocation, "+")[0]
-	prefix2 := strings.Split(filterLocation, "+")[0]
-
-	// Check first 6 characters (city-level matching)
-	if len(prefix1) >= 6 && len(prefix2) >= 6 {
-		return prefix1[:6] == prefix2[:6]
-	}
-
-	// If either is shorter, do simple comparison
-	minLen := len(prefix1)
-	if len(prefix2) < minLen {
-		minLen = len(prefix2)
-	}
-
-	if minLen == 0 {
+	filter, err := Hierarchy(filterLocation)
+	if err != nil {
 		return false
 	}
+	return containsLevel(message, filter[0].Code) || containsLevel(filter, message[0].Code)
+}
 
-	return prefix1[:minLen] == prefix2[:minLen]
+// containsLevel reports whether code is one of the levels.
+func containsLevel(levels []Level, code string) bool {
+	for _, level := range levels {
+		if level.Code == code {
+			return true
+		}
+	}
+	return false
 }
 
 // AllPlustags extracts all plustags (both direct and from #geo hashtags)
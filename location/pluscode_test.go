@@ -0,0 +1,38 @@
+package location
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsLocationMatch(t *testing.T) {
+	tests := []struct {
+		message, filter string
+		want            bool
+	}{
+		{"6FG22222+22", "6FG22222+22", true},
+		{"6FG22222+", "6F000000+", true},
+		{"6F000000+", "6FG22222+", true},
+		{"6FG22222+22", "6FG22200+", true},
+		{"6fg22222+22", "6FG20000+", true},
+		{"8FVC9G8F+6XG", "8FVC9G8F+6X", true},
+		{"6FG22222+", "6FG22300+", false},
+		{"6FG22222+", "6FG30000+", false},
+		{"6FG22222+", "8F000000+", false},
+		{"6FG22222+", "9VXG+2C", false},
+		{"invalid", "6F000000+", false},
+	}
+	for _, tt := range tests {
+		if got := IsLocationMatch(tt.message, tt.filter); got != tt.want {
+			t.Errorf("IsLocationMatch(%q, %q) = %v, want %v", tt.message, tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestExtractGeoHashtags(t *testing.T) {
+	got := ExtractGeoHashtags("At #geo9F469VXG, #geo9f469vxg and #geo6fg22200; not #geo9F46 or #geoX")
+	want := []string{"9F469VXG+", "6FG22200+"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractGeoHashtags = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+package multihash
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Bitcoin base58 alphabet, as used by IPFS
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var bigRadix = big.NewInt(58)
+
+// EncodeBase58 encodes data with the bitcoin base58 alphabet.
+func EncodeBase58(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	mod := new(big.Int)
+
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, bigRadix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+
+	// Leading zero bytes are encoded as leading '1's
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+
+	// Digits were produced least significant first
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// DecodeBase58 decodes a string produced by EncodeBase58.
+func DecodeBase58(s string) ([]byte, error) {
+	n := new(big.Int)
+	for _, c := range s {
+		idx := strings.IndexRune(base58Alphabet, c)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid base58 character: %q", c)
+		}
+		n.Mul(n, bigRadix)
+		n.Add(n, big.NewInt(int64(idx)))
+	}
+
+	leading := 0
+	for leading < len(s) && s[leading] == base58Alphabet[0] {
+		leading++
+	}
+
+	return append(make([]byte, leading), n.Bytes()...), nil
+}
@@ -0,0 +1,91 @@
+package multihash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// SHA2_256 is the multihash function code for sha2-256.
+const SHA2_256 = 0x12
+
+// ErrMismatch is returned by Verify when a message does not hash to its ID.
+var ErrMismatch = errors.New("message does not match its hash")
+
+// Encode wraps a digest in the multihash format
+// (<varint code><varint length><digest>) and returns it in base58.
+func Encode(code uint64, digest []byte) string {
+	buf := binary.AppendUvarint(nil, code)
+	buf = binary.AppendUvarint(buf, uint64(len(digest)))
+	buf = append(buf, digest...)
+	return EncodeBase58(buf)
+}
+
+// Decode parses a base58 multihash and returns its function code and digest.
+func Decode(id string) (uint64, []byte, error) {
+	data, err := DecodeBase58(id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	code, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, nil, fmt.Errorf("invalid multihash code")
+	}
+	data = data[n:]
+
+	length, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, nil, fmt.Errorf("invalid multihash length")
+	}
+	data = data[n:]
+
+	if uint64(len(data)) != length {
+		return 0, nil, fmt.Errorf("multihash length %d does not match digest length %d", length, len(data))
+	}
+	return code, data, nil
+}
+
+// IsID reports whether id has the form of a message ID: a sha2-256
+// multihash with a full digest. Short strings that happen to decode, like
+// "TV", are not.
+func IsID(id string) bool {
+	code, digest, err := Decode(id)
+	return err == nil && code == SHA2_256 && len(digest) == sha256.Size
+}
+
+// Sum returns the content ID of msg: the sha2-256 multihash of its signing
+// bytes, so the ID stays the same when the message is rebroadcast.
+func Sum(msg olnjson.Message) (string, error) {
+	data, err := msg.SigningBytes()
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(data)
+	return Encode(SHA2_256, digest[:]), nil
+}
+
+// Verify checks that id is the content ID of msg.
+func Verify(id string, msg olnjson.Message) error {
+	code, digest, err := Decode(id)
+	if err != nil {
+		return fmt.Errorf("invalid message hash %q: %v", id, err)
+	}
+	if code != SHA2_256 {
+		return fmt.Errorf("unsupported hash function 0x%x", code)
+	}
+
+	data, err := msg.SigningBytes()
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if !bytes.Equal(digest, sum[:]) {
+		return ErrMismatch
+	}
+	return nil
+}
@@ -0,0 +1,535 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/location"
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/pow"
+	"github.com/lapingvino/eolnpoc/seal"
+	"github.com/lapingvino/eolnpoc/signing"
+	"github.com/lapingvino/eolnpoc/trust"
+)
+
+// Reasons for not adding a message, next to signature and hash errors
+var (
+	errCached  = errors.New("already cached")
+	errSeen    = errors.New("already seen")
+	errDamped  = errors.New("origin's messages arrive again too often")
+	errExpired = errors.New("expired")
+	errEvicted = errors.New("lower priority than every cached message")
+)
+
+// MessageEntry wraps a message with metadata for prioritization
+type MessageEntry struct {
+	Hash           string
+	Message        olnjson.Message
+	Priority       int
+	PoWBits        int
+	Plustags       []string // Extracted location codes
+	ProximityScore int      // Based on user's location
+	SigStatus      signing.Status
+	Plaintext      string   // Decrypted text of an encrypted message
+	Private        bool     // Message was encrypted to us and decrypted
+	Channel        string   // Name of the joined channel the message was decrypted with
+	ReplyTo        []string // Hashes of the messages this one mentions, see Thread
+	FirstSeen      time.Time
+	LastSent       time.Time
+}
+
+// Text returns the text to show for the entry, decrypted if possible.
+func (e *MessageEntry) Text() string {
+	if e.decrypted() {
+		return e.Plaintext
+	}
+	return e.Message.Raw
+}
+
+// Hidden reports whether the entry is encrypted and could not be decrypted.
+// Such messages are kept and rebroadcast but never shown.
+func (e *MessageEntry) Hidden() bool {
+	return !e.decrypted() && seal.IsEncrypted(e.Message.Raw)
+}
+
+func (e *MessageEntry) decrypted() bool {
+	return e.Private || e.Channel != ""
+}
+
+// AddMessage verifies a message and adds it to the cache, evicting the
+// entry with the lowest priority if the cache is full. It returns why the
+// message was not added, if it was not.
+func (n *Node) AddMessage(hash string, msg olnjson.Message) error {
+	entry, err := n.addMessage(hash, msg)
+	if err == nil && n.onMessage != nil {
+		n.onMessage(entry)
+	}
+	return err
+}
+
+// addMessage adds a message and returns a copy of its new entry, or why it
+// was not added.
+func (n *Node) addMessage(hash string, msg olnjson.Message) (MessageEntry, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// Drop copies of seen messages of an origin in a rebroadcast storm
+	// without checking them
+	if n.seen.damp(hash, time.Now()) {
+		return MessageEntry{}, errDamped
+	}
+
+	// Reject entries whose key is not the hash of their content. Nothing
+	// of the message is used before this.
+	if err := multihash.Verify(hash, msg); err != nil {
+		return MessageEntry{}, err
+	}
+
+	// Already cached: keep the shortest path it came by. The hash does not
+	// cover the hop count, so copies only differ in that.
+	if entry, exists := n.cache[hash]; exists {
+		n.seen.add(hash, msg)
+		if msg.Hops < entry.Message.Hops {
+			entry.Message.Hops = msg.Hops
+			entry.Priority = n.calculatePriority(entry)
+		}
+		return MessageEntry{}, errCached
+	}
+
+	// Seen before but evicted or cleared, don't take it in again unless
+	// we asked for it
+	if _, asked := n.wanted[hash]; n.seen.has(hash) && !asked {
+		n.seen.add(hash, msg)
+		return MessageEntry{}, errSeen
+	}
+
+	// Drop messages whose TTL has passed
+	if time.Since(msg.Timestamp) > time.Duration(msg.TTL)*24*time.Hour {
+		return MessageEntry{}, errExpired
+	}
+
+	// Verify signature and apply policy
+	sigStatus := signing.Check(msg)
+	if !n.SigPolicy.Accepts(sigStatus) {
+		return MessageEntry{}, fmt.Errorf("signature %s", sigStatus)
+	}
+
+	// Detect PoW
+	powBits := DetectPoW(msg.Raw)
+
+	// Try to decrypt direct and channel messages
+	plaintext, private, channel := n.decrypt(msg.Raw)
+
+	// Take in the trust attestations of signed public messages
+	if sigStatus == signing.Valid && !private && channel == "" {
+		attestations := trust.ParseAttestations(msg.Raw, msg.Timestamp)
+		if len(attestations) > 0 && n.Contacts.Attest(msg.Origin.PubKey, attestations) {
+			n.recalculatePriorities()
+		}
+	}
+
+	// Extract plustags (both direct and from #geo hashtags)
+	text := msg.Raw
+	if private || channel != "" {
+		text = plaintext
+	}
+	plustags := n.extractPlustags(text)
+
+	entry := &MessageEntry{
+		Hash:           hash,
+		Message:        msg,
+		PoWBits:        powBits,
+		Plustags:       plustags,
+		ProximityScore: n.proximityScore(plustags),
+		SigStatus:      sigStatus,
+		Plaintext:      plaintext,
+		Private:        private,
+		Channel:        channel,
+		ReplyTo:        replyTargets(text),
+		FirstSeen:      time.Now(),
+		LastSent:       time.Now(),
+	}
+	entry.Priority = n.calculatePriority(entry)
+
+	n.cache[hash] = entry
+	n.seen.add(hash, msg)
+	n.Index.AddMessage(hash, msg)
+
+	// Evict lowest priority if cache is full
+	if len(n.cache) > n.MaxCacheSize {
+		n.evictLowestPriority()
+		if _, ok := n.cache[hash]; !ok {
+			return MessageEntry{}, errEvicted
+		}
+	}
+
+	return *entry, nil
+}
+
+// decrypt tries to open an encrypted message with our identity and the
+// joined channels. It returns the plaintext, whether it was a direct message
+// to us and the name of the channel it belongs to.
+func (n *Node) decrypt(raw string) (string, bool, string) {
+	if seal.IsDirect(raw) {
+		if text, err := seal.OpenDirect(n.Key, raw); err == nil {
+			return text, true, ""
+		}
+	}
+	if seal.IsChannel(raw) {
+		for name, ch := range n.channels {
+			if text, err := ch.Open(raw); err == nil {
+				return text, false, name
+			}
+		}
+	}
+	return "", false, ""
+}
+
+func (n *Node) calculatePriority(entry *MessageEntry) int {
+	msg := entry.Message
+	priority := 100 // BaseScore
+
+	// FilterBonus
+	if n.matchesFilters(entry) {
+		priority += 1000
+	}
+
+	// ProximityScore (if user has a location filter)
+	priority += entry.ProximityScore
+
+	// RecencyScore (TTL remaining as percentage)
+	age := time.Since(msg.Timestamp)
+	ttlDuration := time.Duration(msg.TTL) * 24 * time.Hour
+	if age < ttlDuration {
+		remaining := 1.0 - (float64(age) / float64(ttlDuration))
+		priority += int(remaining * 100)
+	}
+
+	// PoWScore
+	priority += entry.PoWBits * 50
+
+	// HopsScore (negative)
+	priority -= msg.Hops * 10
+
+	// TrustScore, only for origins that proved who they are
+	if entry.SigStatus == signing.Valid {
+		if n.Contacts.Follows(msg.Origin.PubKey) {
+			priority += 1000
+		}
+		priority += n.Contacts.Score(msg.Origin.PubKey) * 5
+	}
+
+	return priority
+}
+
+// extractPlustags returns the full plustags in text plus its short codes,
+// recovered relative to the first location filter if there is one.
+func (n *Node) extractPlustags(text string) []string {
+	reference := ""
+	if len(n.filters.Locations) > 0 {
+		reference = n.filters.Locations[0]
+	}
+	return extractPlustags(text, reference)
+}
+
+// extractPlustags returns the full plustags in text plus its short codes,
+// recovered relative to reference unless that is empty.
+func extractPlustags(text, reference string) []string {
+	plustags := location.AllPlustags(text)
+	if reference == "" {
+		return plustags
+	}
+
+	for _, code := range location.RecoverShortCodes(text, reference) {
+		found := false
+		for _, existing := range plustags {
+			if existing == code {
+				found = true
+				break
+			}
+		}
+		if !found {
+			plustags = append(plustags, code)
+		}
+	}
+	return plustags
+}
+
+// proximityScore returns the best proximity between any of the message
+// locations and any location filter, within ProximityRadius.
+func (n *Node) proximityScore(plustags []string) int {
+	best := 0
+	for _, msgLoc := range plustags {
+		for _, userLoc := range n.filters.Locations {
+			score := location.Proximity(msgLoc, userLoc, n.ProximityRadius)
+			if score > best {
+				best = score
+			}
+		}
+	}
+	return best
+}
+
+// MatchesFilters reports whether a cached message matches any hashtag or
+// location filter.
+func (n *Node) MatchesFilters(entry *MessageEntry) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.matchesFilters(entry)
+}
+
+func (n *Node) matchesFilters(entry *MessageEntry) bool {
+	if len(n.filters.Hashtags) == 0 && len(n.filters.Locations) == 0 {
+		return false
+	}
+
+	// Check hashtags
+	for _, filterTag := range n.filters.Hashtags {
+		for _, msgTag := range entry.Message.Tags {
+			if strings.EqualFold(filterTag, msgTag) {
+				return true
+			}
+		}
+	}
+
+	// Check locations, in either direction of the area hierarchy
+	for _, locFilter := range n.filters.Locations {
+		for _, plustag := range entry.Plustags {
+			if location.IsLocationMatch(plustag, locFilter) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// DetectPoW returns the number of valid proof-of-work bits of a message
+// text, 0 if it is not in PoW format.
+func DetectPoW(msgText string) int {
+	// Check if message looks like PoW format
+	parts := strings.Split(msgText, ";")
+	if len(parts) < 4 {
+		return 0
+	}
+
+	// Try to parse as PoW message
+	_, _, _, _, err := pow.ParsePoWMessage(msgText)
+	if err != nil {
+		return 0
+	}
+
+	// Validate PoW
+	powBits := pow.ValidatePoW(msgText)
+	return powBits
+}
+
+func (n *Node) evictLowestPriority() {
+	var lowest *MessageEntry
+	var lowestHash string
+
+	for hash, entry := range n.cache {
+		if lowest == nil || entry.Priority < lowest.Priority {
+			lowest = entry
+			lowestHash = hash
+		}
+	}
+
+	if lowestHash != "" {
+		delete(n.cache, lowestHash)
+		n.Index.Forget(lowestHash)
+	}
+}
+
+func (n *Node) recalculatePriorities() {
+	for _, entry := range n.cache {
+		// Recalculate proximity if location filters changed
+		entry.ProximityScore = n.proximityScore(entry.Plustags)
+
+		// Recalculate priority
+		entry.Priority = n.calculatePriority(entry)
+	}
+}
+
+// Entry returns a copy of the cached entry with the given hash.
+func (n *Node) Entry(hash string) (MessageEntry, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	entry, ok := n.cache[hash]
+	if !ok {
+		return MessageEntry{}, false
+	}
+	return *entry, true
+}
+
+// FindEntry returns a visible cached entry whose hash starts with prefix.
+func (n *Node) FindEntry(prefix string) (MessageEntry, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for hash, entry := range n.cache {
+		if strings.HasPrefix(hash, prefix) && n.shown(entry) {
+			return *entry, true
+		}
+	}
+	return MessageEntry{}, false
+}
+
+// Messages returns copies of the visible cached entries, highest priority
+// first.
+func (n *Node) Messages() []MessageEntry {
+	return n.Search(SearchQuery{})
+}
+
+// CacheSize returns the number of cached messages, including hidden ones.
+func (n *Node) CacheSize() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.cache)
+}
+
+// ClearCache empties the cache and returns the number of messages removed.
+// The messages stay seen, so they are not taken in again, but they are
+// dropped from the index.
+func (n *Node) ClearCache() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	count := len(n.cache)
+	for hash := range n.cache {
+		n.Index.Forget(hash)
+	}
+	n.cache = make(map[string]*MessageEntry)
+	return count
+}
+
+// Stats summarizes the cache.
+type Stats struct {
+	Cached      int
+	MaxCache    int
+	AverageAge  time.Duration // Since first seen
+	MinPriority int
+	MaxPriority int
+}
+
+// Stats returns statistics about the cache.
+func (n *Node) Stats() Stats {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	stats := Stats{Cached: len(n.cache), MaxCache: n.MaxCacheSize}
+	if len(n.cache) == 0 {
+		return stats
+	}
+
+	var totalAge time.Duration
+	first := true
+	for _, entry := range n.cache {
+		totalAge += time.Since(entry.FirstSeen)
+		if first {
+			stats.MinPriority = entry.Priority
+			stats.MaxPriority = entry.Priority
+			first = false
+		} else {
+			if entry.Priority < stats.MinPriority {
+				stats.MinPriority = entry.Priority
+			}
+			if entry.Priority > stats.MaxPriority {
+				stats.MaxPriority = entry.Priority
+			}
+		}
+	}
+	stats.AverageAge = totalAge / time.Duration(len(n.cache))
+	return stats
+}
+
+// SearchMode selects what Search compares the query with.
+type SearchMode int
+
+const (
+	SearchAll      SearchMode = iota // Text, tags and plustags, by substring
+	SearchTag                        // Exact hashtag
+	SearchLocation                   // Plustags within ProximityRadius
+	SearchText                       // Text only
+)
+
+// SearchQuery selects cached messages. An empty Query matches everything.
+type SearchQuery struct {
+	Mode  SearchMode
+	Query string
+}
+
+// Search returns copies of the visible cached entries matching q, highest
+// priority first.
+func (n *Node) Search(q SearchQuery) []MessageEntry {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var matches []MessageEntry
+	queryLower := strings.ToLower(q.Query)
+
+	// Search through cache
+	for _, entry := range n.cache {
+		if !n.shown(entry) {
+			continue
+		}
+		if q.Query == "" || n.searchMatch(entry, q.Mode, q.Query, queryLower) {
+			matches = append(matches, *entry)
+		}
+	}
+
+	// Sort by priority (most relevant first)
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Priority > matches[j].Priority
+	})
+	return matches
+}
+
+func (n *Node) searchMatch(entry *MessageEntry, mode SearchMode, query, queryLower string) bool {
+	switch mode {
+	case SearchTag:
+		// Search for exact tag match
+		for _, tag := range entry.Message.Tags {
+			if strings.EqualFold(tag, query) {
+				return true
+			}
+		}
+
+	case SearchLocation:
+		// Use proximity scoring for location matching
+		for _, plustag := range entry.Plustags {
+			if location.Proximity(plustag, query, n.ProximityRadius) > 0 {
+				return true
+			}
+		}
+
+	case SearchText:
+		// Search only in message text
+		return strings.Contains(strings.ToLower(entry.Text()), queryLower)
+
+	default:
+		// Search in message text
+		if strings.Contains(strings.ToLower(entry.Text()), queryLower) {
+			return true
+		}
+		// Search in tags
+		for _, tag := range entry.Message.Tags {
+			if strings.Contains(strings.ToLower(tag), queryLower) {
+				return true
+			}
+		}
+		// Search in plustags
+		for _, plustag := range entry.Plustags {
+			if strings.Contains(strings.ToLower(plustag), queryLower) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
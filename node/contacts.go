@@ -0,0 +1,37 @@
+package node
+
+import (
+	"github.com/lapingvino/eolnpoc/trust"
+)
+
+// SetContact stores what the user decided about an origin and updates the
+// priorities of cached messages.
+func (n *Node) SetContact(c trust.Contact) error {
+	if err := n.Contacts.Set(c); err != nil {
+		return err
+	}
+	n.contactsChanged()
+	return nil
+}
+
+// RemoveContact forgets an origin and reports whether it was a contact.
+func (n *Node) RemoveContact(pubKey string) (bool, error) {
+	removed, err := n.Contacts.Remove(pubKey)
+	if removed {
+		n.contactsChanged()
+	}
+	return removed, err
+}
+
+func (n *Node) contactsChanged() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.recalculatePriorities()
+}
+
+// PublishAttestation publishes a signed statement that we trust pubKey at
+// level, so nodes trusting us can extend some of that trust to it. Level 0
+// takes an earlier attestation back.
+func (n *Node) PublishAttestation(pubKey string, level int) (string, error) {
+	return n.Publish(trust.FormatAttestation(pubKey, level), 0)
+}
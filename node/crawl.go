@@ -0,0 +1,44 @@
+package node
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/feed"
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// crawlLoop crawls the given feeds now and then every interval, adding
+// the messages found to the cache.
+func (n *Node) crawlLoop(start []string, interval time.Duration) {
+	crawler := feed.NewCrawler(func(url string, format *olnjson.Format) {
+		n.Index.Merge(format)
+		for hash, msg := range format.Messages {
+			n.AddMessage(hash, msg)
+		}
+	})
+	crawler.OnError = func(url string, err error) {
+		log.Printf("Skipping feed %s: %v", url, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-n.stopChan
+		cancel()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		crawler.Crawl(ctx, start)
+
+		select {
+		case <-n.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
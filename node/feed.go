@@ -0,0 +1,264 @@
+package node
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/index"
+	"github.com/lapingvino/eolnpoc/location"
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// FeedQuery selects which cached messages are served.
+type FeedQuery struct {
+	Tags    []string // Any of these
+	Plustag string
+	Origin  string
+	Since   time.Time
+	Hashes  []string // Only these messages, empty for any
+	Limit   int      // Most recent messages only, 0 for all
+}
+
+// ParseFeedQuery reads the tag, plustag, origin and since parameters.
+// tag may be repeated or comma-separated, since is parsed by ParseSince.
+func ParseFeedQuery(values url.Values) (FeedQuery, error) {
+	var tags []string
+	for _, value := range values["tag"] {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	var since time.Time
+	if value := values.Get("since"); value != "" {
+		t, err := ParseSince(value)
+		if err != nil {
+			return FeedQuery{}, err
+		}
+		since = t
+	}
+
+	return NewFeedQuery(tags, values.Get("plustag"), values.Get("origin"), since)
+}
+
+// NewFeedQuery normalizes and checks the parts of a query: tags get their
+// leading # and the plustag must be a full plus code.
+func NewFeedQuery(tags []string, plustag, origin string, since time.Time) (FeedQuery, error) {
+	q := FeedQuery{
+		Plustag: strings.ToUpper(plustag),
+		Origin:  origin,
+		Since:   since,
+	}
+
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, "#") {
+			tag = "#" + tag
+		}
+		q.Tags = append(q.Tags, tag)
+	}
+	if q.Plustag != "" && !location.ValidatePluscode(q.Plustag) {
+		return q, fmt.Errorf("invalid plustag: %s", q.Plustag)
+	}
+
+	return q, nil
+}
+
+// ParseSince reads a point in time as an RFC 3339 timestamp, Unix seconds
+// or a duration back from now like 24h.
+func ParseSince(value string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since: %s", value)
+}
+
+// matches reports whether a cached entry passes the query.
+func (q FeedQuery) matches(entry *MessageEntry) bool {
+	msg := entry.Message
+
+	if len(q.Tags) > 0 {
+		found := false
+		for _, tag := range msg.Tags {
+			for _, want := range q.Tags {
+				if strings.EqualFold(tag, want) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if q.Plustag != "" {
+		found := false
+		for _, plustag := range publicPlustags(entry) {
+			for _, parent := range location.GetParentPlustags(plustag) {
+				if parent == q.Plustag {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if q.Origin != "" && msg.Origin.PubKey != q.Origin && msg.Origin.Display != q.Origin {
+		return false
+	}
+
+	if !q.Since.IsZero() && msg.Timestamp.Before(q.Since) {
+		return false
+	}
+
+	if len(q.Hashes) > 0 && !containsTag(q.Hashes, entry.Hash) {
+		return false
+	}
+
+	return true
+}
+
+// publicPlustags returns the plustags of an entry that may be shared.
+// Locations found in decrypted text stay private.
+func publicPlustags(entry *MessageEntry) []string {
+	if entry.decrypted() {
+		return nil
+	}
+	return entry.Plustags
+}
+
+// FeedFormat builds the document describing this node and the cached
+// messages that pass the query.
+func (n *Node) FeedFormat(q FeedQuery) olnjson.Format {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	format := olnjson.Format{
+		Server:   n.ServerInfo(),
+		Messages: make(map[string]olnjson.Message),
+		Index:    make(map[string][]string),
+		Feeds:    n.Feeds,
+		Push:     n.Push,
+	}
+
+	var entries []*MessageEntry
+	for _, entry := range n.cache {
+		if q.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if q.Limit > 0 && len(entries) > q.Limit {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Message.Timestamp.After(entries[j].Message.Timestamp)
+		})
+		entries = entries[:q.Limit]
+	}
+
+	for _, entry := range entries {
+		hash := entry.Hash
+		format.Messages[hash] = entry.Message
+
+		keys := make(map[string]bool)
+		for _, tag := range entry.Message.Tags {
+			keys[tag] = true
+		}
+		for _, plustag := range publicPlustags(entry) {
+			for _, parent := range location.GetParentPlustags(plustag) {
+				keys[parent] = true
+			}
+		}
+		for key := range keys {
+			format.Index[key] = append(format.Index[key], hash)
+		}
+	}
+
+	// Point at the other feeds we know hold messages for the query
+	for _, key := range append([]string{q.Plustag}, q.Tags...) {
+		if key == "" {
+			continue
+		}
+		for _, ref := range n.Index.Lookup(key) {
+			if index.IsLink(ref) && ref != n.Link {
+				format.Index[key] = append(format.Index[key], ref)
+			}
+		}
+	}
+
+	// Keep the document stable so its ETag only changes with the content
+	for _, hashes := range format.Index {
+		sort.Strings(hashes)
+	}
+
+	return format
+}
+
+func (n *Node) handleFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		allow := "GET, HEAD"
+		if n.AcceptPush {
+			allow += ", POST"
+		}
+		w.Header().Set("Allow", allow)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := ParseFeedQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := n.FeedFormat(q)
+	data, err := json.Marshal(format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Feeds are public, let browsers fetch them from anywhere
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	// Let crawlers skip unchanged feeds
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Error writing feed: %v", err)
+	}
+}
+
+// Handler returns an HTTP handler serving the feed at / and /oln.json.
+// Pushes are POSTed to the same paths.
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", n.handleFeed)
+	mux.HandleFunc("/oln.json", n.handleFeed)
+	mux.HandleFunc("POST /{$}", n.handlePush)
+	mux.HandleFunc("POST /oln.json", n.handlePush)
+	return mux
+}
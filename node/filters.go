@@ -0,0 +1,128 @@
+package node
+
+import (
+	"strings"
+)
+
+// Filters define what the user is interested in. Matching messages get a
+// higher priority and, with filters set, the node only subscribes to their
+// subjects.
+type Filters struct {
+	Hashtags  []string
+	Locations []string
+}
+
+func (f Filters) clone() Filters {
+	return Filters{
+		Hashtags:  append([]string(nil), f.Hashtags...),
+		Locations: append([]string(nil), f.Locations...),
+	}
+}
+
+// Empty reports whether no filters are set.
+func (f Filters) Empty() bool {
+	return len(f.Hashtags) == 0 && len(f.Locations) == 0
+}
+
+// Filters returns a copy of the current filters.
+func (n *Node) Filters() Filters {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.filters.clone()
+}
+
+// AddHashtagFilters adds hashtag filters and returns those that were not
+// set yet.
+func (n *Node) AddHashtagFilters(tags ...string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var added []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			// Check if already exists
+			found := false
+			for _, existing := range n.filters.Hashtags {
+				if existing == tag {
+					found = true
+					break
+				}
+			}
+			if !found {
+				n.filters.Hashtags = append(n.filters.Hashtags, tag)
+				added = append(added, tag)
+			}
+		}
+	}
+	n.filtersChanged()
+	return added
+}
+
+// RemoveHashtagFilter removes a hashtag filter and reports whether it was
+// set.
+func (n *Node) RemoveHashtagFilter(tag string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i, t := range n.filters.Hashtags {
+		if t == tag {
+			n.filters.Hashtags = append(n.filters.Hashtags[:i], n.filters.Hashtags[i+1:]...)
+			n.filtersChanged()
+			return true
+		}
+	}
+	return false
+}
+
+// AddLocationFilter adds a location filter and reports whether it was not
+// set yet. Codes are not validated; invalid ones never match.
+func (n *Node) AddLocationFilter(locationCode string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	locationCode = strings.TrimSpace(locationCode)
+
+	// Check if already exists
+	for _, existing := range n.filters.Locations {
+		if existing == locationCode {
+			return false
+		}
+	}
+
+	n.filters.Locations = append(n.filters.Locations, locationCode)
+	n.filtersChanged()
+	return true
+}
+
+// ClearLocationFilters removes all location filters and returns how many
+// there were.
+func (n *Node) ClearLocationFilters() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	count := len(n.filters.Locations)
+	if count == 0 {
+		return 0
+	}
+	n.filters.Locations = []string{}
+	n.filtersChanged()
+	return count
+}
+
+// ClearFilters removes all filters.
+func (n *Node) ClearFilters() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.filters.Hashtags = []string{}
+	n.filters.Locations = []string{}
+	n.filtersChanged()
+}
+
+// filtersChanged updates priorities and subscriptions after the filters
+// changed. Callers must hold n.mu.
+func (n *Node) filtersChanged() {
+	n.recalculatePriorities()
+	n.updateSubscriptions()
+}
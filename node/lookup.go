@@ -0,0 +1,66 @@
+package node
+
+import (
+	"context"
+
+	"github.com/lapingvino/eolnpoc/index"
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/signing"
+)
+
+// CachedMessage returns a cached message.
+func (n *Node) CachedMessage(hash string) (olnjson.Message, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	entry, ok := n.cache[hash]
+	if !ok {
+		return olnjson.Message{}, false
+	}
+	return entry.Message, true
+}
+
+// MessageText returns the text to show for a message, decrypted if it is
+// cached and we could open it.
+func (n *Node) MessageText(hash string, msg olnjson.Message) string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if entry, ok := n.cache[hash]; ok && !entry.Hidden() {
+		return entry.Text()
+	}
+	return msg.Raw
+}
+
+// newResolver returns a resolver over the node's index that adds the
+// messages of fetched documents to the cache.
+func (n *Node) newResolver() *index.Resolver {
+	resolver := index.NewResolver(n.Index, n.CachedMessage)
+	resolver.Fetched = func(url string, format *olnjson.Format) {
+		for hash, msg := range format.Messages {
+			n.AddMessage(hash, msg)
+		}
+	}
+	return resolver
+}
+
+// Lookup returns the messages stored under key in the index that pass the
+// signature policy and the rules, fetching linked documents as needed.
+// Links that could not be fetched are reported in the error, next to
+// whatever was found.
+func (n *Node) Lookup(ctx context.Context, key string) (map[string]olnjson.Message, error) {
+	found, err := n.resolver.Resolve(ctx, key)
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for hash, msg := range found {
+		entry, ok := n.cache[hash]
+		if !ok {
+			entry = &MessageEntry{Message: msg, PoWBits: DetectPoW(msg.Raw), SigStatus: signing.Check(msg)}
+		}
+		if !n.SigPolicy.Accepts(entry.SigStatus) || n.rejects(entry) {
+			delete(found, hash)
+		}
+	}
+	return found, err
+}
@@ -0,0 +1,401 @@
+// Package node is an OLN node: it keeps a prioritized cache of the
+// messages it receives, filters and searches them, reconciles its cache
+// with other nodes, answers their queries and can serve its cache as a JSON
+// feed. olnnode is a command line front end for it; bots and services can
+// run one the same way.
+package node
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/feed"
+	"github.com/lapingvino/eolnpoc/index"
+	"github.com/lapingvino/eolnpoc/location"
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/seal"
+	"github.com/lapingvino/eolnpoc/signing"
+	"github.com/lapingvino/eolnpoc/transport"
+	"github.com/lapingvino/eolnpoc/trust"
+)
+
+// Subjects nodes talk on, besides those derived from tags
+// (see transport.Subjects).
+const (
+	MessageSubject = "oln.messages.v1"
+	QuerySubject   = "oln.query.v1"
+	SyncSubject    = "oln.sync.v1"
+
+	// Encrypted messages carry no tags, so they are also published here,
+	// where every node receives them whatever its filters.
+	SealedSubject = "oln.sealed.v1"
+
+	// Replies are only ever published below this prefix, so a query
+	// cannot make nodes flood the message subject or any other.
+	ReplyPrefix = "oln.reply."
+
+	// Defaults for Options
+	DefaultMaxCache      = 100
+	DefaultSyncInterval  = 5 * time.Minute
+	DefaultCrawlInterval = 10 * time.Minute
+
+	maxHops = 3
+	ttlDays = 7
+
+	// How long index references merged from other documents are kept
+	// without being merged again
+	mergedIndexTTL = ttlDays * 24 * time.Hour
+)
+
+// Options configure a Node. Transport and Key are required.
+type Options struct {
+	Transport       transport.Transport
+	Key             ed25519.PrivateKey // Identity messages are signed with
+	Origin          olnjson.Origin     // Display and server name of our messages, PubKey comes from Key
+	Filters         Filters            // Initial filters
+	MaxCacheSize    int                // DefaultMaxCache if 0
+	SyncInterval    time.Duration      // How often to exchange cache summaries, DefaultSyncInterval if 0
+	AutoPoWBits     int                // PoW applied to every published message
+	ProximityRadius float64            // Metres within which locations count as near, location.DefaultProximityRadius if 0
+	SigPolicy       signing.Policy
+	Name            string   // Server name in published documents
+	Link            string   // Where our feed can be fetched
+	Feeds           []string // Other known feeds
+	Push            []string // Nodes we push our messages to
+	AcceptPush      bool     // Take messages POSTed by peers
+	PushMinPoW      int      // PoW bits required on pushed messages
+	Crawl           []string // Feeds to crawl for messages in the background
+	CrawlInterval   time.Duration
+
+	// Rules keep unwanted messages out
+	Rules Rules
+
+	// Contacts are the followed, trusted and blocked origins. If nil, the
+	// node starts with an empty list that is not saved.
+	Contacts *trust.Store
+
+	// OnMessage, if set, is called for every message added to the cache,
+	// including hidden ones. It runs on the goroutine that received the
+	// message and gets a copy of the entry.
+	OnMessage func(entry MessageEntry)
+}
+
+// Node manages a cache of messages on a transport.
+type Node struct {
+	Transport       transport.Transport
+	MaxCacheSize    int
+	SyncInterval    time.Duration
+	AutoPoWBits     int
+	ProximityRadius float64
+	Key             ed25519.PrivateKey
+	Origin          olnjson.Origin
+	SigPolicy       signing.Policy
+	Name            string
+	Link            string
+	Feeds           []string
+	Push            []string
+	AcceptPush      bool
+	PushMinPoW      int
+	Index           *index.Index // What we know is where, including remote links
+	Contacts        *trust.Store // Who we believe, see SetContact
+
+	cache         map[string]*MessageEntry
+	filters       Filters
+	rules         Rules
+	words         []*regexp.Regexp         // Compiled Rules.Words
+	channels      map[string]*seal.Channel // Joined channels by name
+	activeChannel *seal.Channel            // Channel typed messages go to, nil for public
+	onMessage     func(MessageEntry)
+	crawl         []string
+	crawlInterval time.Duration
+	mu            sync.RWMutex
+	stopChan      chan bool
+	stopOnce      sync.Once
+	subs          map[string]transport.Subscription // Filter subscriptions by subject
+	fixedSubs     []transport.Subscription          // Query and sync subscriptions
+	inbox         string                            // Subject peers send sync replies to
+	wanted        map[string]time.Time              // Hashes asked from peers, by when
+	seen          *seenSet                          // Every accepted message until its TTL ends
+	pushClient    *feed.Client
+	resolver      *index.Resolver
+}
+
+// New returns a node with the given options. Call Start to connect it.
+func New(opts Options) (*Node, error) {
+	if opts.Transport == nil {
+		return nil, errors.New("node: no transport")
+	}
+	if len(opts.Key) != ed25519.PrivateKeySize {
+		return nil, errors.New("node: no identity key")
+	}
+	if opts.MaxCacheSize == 0 {
+		opts.MaxCacheSize = DefaultMaxCache
+	}
+	if opts.SyncInterval == 0 {
+		opts.SyncInterval = DefaultSyncInterval
+	}
+	if opts.ProximityRadius == 0 {
+		opts.ProximityRadius = location.DefaultProximityRadius
+	}
+	if opts.CrawlInterval == 0 {
+		opts.CrawlInterval = DefaultCrawlInterval
+	}
+	if opts.Contacts == nil {
+		opts.Contacts = trust.NewStore()
+	}
+	// Documents list them as arrays, never null
+	if opts.Feeds == nil {
+		opts.Feeds = []string{}
+	}
+	if opts.Push == nil {
+		opts.Push = []string{}
+	}
+	inbox, err := NewInbox()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{
+		Transport:       opts.Transport,
+		MaxCacheSize:    opts.MaxCacheSize,
+		SyncInterval:    opts.SyncInterval,
+		AutoPoWBits:     opts.AutoPoWBits,
+		ProximityRadius: opts.ProximityRadius,
+		Key:             opts.Key,
+		Origin:          opts.Origin,
+		SigPolicy:       opts.SigPolicy,
+		Name:            opts.Name,
+		Link:            opts.Link,
+		Feeds:           opts.Feeds,
+		Push:            opts.Push,
+		AcceptPush:      opts.AcceptPush,
+		PushMinPoW:      opts.PushMinPoW,
+		Index:           index.New(),
+		Contacts:        opts.Contacts,
+		cache:           make(map[string]*MessageEntry),
+		filters:         opts.Filters.clone(),
+		channels:        make(map[string]*seal.Channel),
+		onMessage:       opts.OnMessage,
+		crawl:           opts.Crawl,
+		crawlInterval:   opts.CrawlInterval,
+		stopChan:        make(chan bool),
+		subs:            make(map[string]transport.Subscription),
+		inbox:           inbox,
+		wanted:          make(map[string]time.Time),
+		seen:            newSeenSet(),
+		pushClient:      feed.NewClient(),
+	}
+	n.resolver = n.newResolver()
+	if err := n.SetRules(opts.Rules); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Start subscribes to the subjects of the filters, queries and cache sync
+// and starts the background work. It returns once subscribed; use Fetch to
+// ask the other nodes for what was sent before.
+func (n *Node) Start() error {
+	for subject, handler := range map[string]transport.Handler{
+		QuerySubject: n.answerQuery,
+		SyncSubject:  n.answerSummary,
+		n.inbox:      n.handleSyncReply,
+	} {
+		sub, err := n.Transport.Subscribe(subject, handler)
+		if err != nil {
+			n.unsubscribe()
+			return err
+		}
+		n.fixedSubs = append(n.fixedSubs, sub)
+	}
+
+	n.mu.Lock()
+	n.updateSubscriptions()
+	n.mu.Unlock()
+
+	go n.syncLoop()
+	go n.cleanupLoop()
+	if len(n.crawl) > 0 {
+		go n.crawlLoop(n.crawl, n.crawlInterval)
+	}
+	return nil
+}
+
+// Close stops the background work and unsubscribes. It does not close the
+// transport.
+func (n *Node) Close() error {
+	n.stopOnce.Do(func() {
+		close(n.stopChan)
+		n.unsubscribe()
+	})
+	return nil
+}
+
+func (n *Node) unsubscribe() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for subject, sub := range n.subs {
+		sub.Unsubscribe()
+		delete(n.subs, subject)
+	}
+	for _, sub := range n.fixedSubs {
+		sub.Unsubscribe()
+	}
+	n.fixedSubs = nil
+}
+
+// PubKey returns the encoded public key of the node's identity.
+func (n *Node) PubKey() string {
+	return signing.EncodePubKey(n.Key.Public().(ed25519.PublicKey))
+}
+
+// ServerInfo describes this node in the documents it publishes.
+func (n *Node) ServerInfo() olnjson.ServerInfo {
+	return olnjson.ServerInfo{
+		Link:       n.Link,
+		Name:       n.Name,
+		PubKey:     n.PubKey(),
+		AcceptPush: n.AcceptPush,
+	}
+}
+
+// Subjects returns the subjects the node receives messages on.
+func (n *Node) Subjects() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.subjects()
+}
+
+// subjects returns the subjects of the current filters. Unless that is
+// the main subject, encrypted messages and trust attestations are received
+// too. Callers must hold n.mu.
+func (n *Node) subjects() []string {
+	subjects := FilterSubjects(n.filters.Hashtags, n.filters.Locations)
+	if len(subjects) == 1 && subjects[0] == MessageSubject {
+		return subjects
+	}
+	return append(subjects, SealedSubject, transport.TagSubject(trust.AttestationTag))
+}
+
+// updateSubscriptions subscribes to the subjects of the current filters
+// and drops the others. Callers must hold n.mu.
+func (n *Node) updateSubscriptions() {
+	wanted := make(map[string]bool)
+	for _, subject := range n.subjects() {
+		wanted[subject] = true
+	}
+
+	for subject, sub := range n.subs {
+		if !wanted[subject] {
+			sub.Unsubscribe()
+			delete(n.subs, subject)
+		}
+	}
+
+	for subject := range wanted {
+		if _, ok := n.subs[subject]; ok {
+			continue
+		}
+		sub, err := n.Transport.Subscribe(subject, n.Receive)
+		if err != nil {
+			log.Printf("Failed to subscribe to %s: %v", subject, err)
+			continue
+		}
+		n.subs[subject] = sub
+	}
+}
+
+// Receive handles a document from any of the node's subscriptions or
+// another source: its index is merged and its messages are added.
+func (n *Node) Receive(format *olnjson.Format) {
+	n.Index.Merge(format)
+	for hash, msg := range format.Messages {
+		n.AddMessage(hash, msg)
+	}
+}
+
+// PublishAll publishes format on the main message subject and on the
+// subjects derived from tags. Documents with encrypted messages also go to
+// SealedSubject.
+func PublishAll(t transport.Transport, format *olnjson.Format, tags []string) error {
+	if err := t.Publish(MessageSubject, format); err != nil {
+		return err
+	}
+	for _, msg := range format.Messages {
+		if seal.IsEncrypted(msg.Raw) {
+			if err := t.Publish(SealedSubject, format); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	for _, subject := range transport.Subjects(tags) {
+		if err := t.Publish(subject, format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FilterSubjects returns the subjects to receive messages on for the
+// given hashtag and location filters, or the main subject if there are
+// none. Locations that are not full plus codes are skipped. A location
+// subject carries the messages within its area only: those of larger areas
+// come with sync, and those of neighbouring areas not at all.
+func FilterSubjects(tags, locations []string) []string {
+	subjects := transport.Subjects(tags)
+	for _, code := range locations {
+		if subject, err := transport.GeoSubject(strings.ToUpper(code)); err == nil {
+			subjects = append(subjects, subject)
+		}
+	}
+	if len(subjects) == 0 {
+		return []string{MessageSubject}
+	}
+	return subjects
+}
+
+func (n *Node) cleanupLoop() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stopChan:
+			return
+		case <-ticker.C:
+			n.cleanupExpired()
+		}
+	}
+}
+
+func (n *Node) cleanupExpired() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+
+	for hash, entry := range n.cache {
+		age := now.Sub(entry.Message.Timestamp)
+		ttlDuration := time.Duration(entry.Message.TTL) * 24 * time.Hour
+
+		if age > ttlDuration {
+			delete(n.cache, hash)
+			n.Index.Forget(hash)
+		}
+	}
+	n.Index.Expire(now.Add(-mergedIndexTTL))
+
+	n.seen.expire(now)
+
+	for hash, asked := range n.wanted {
+		if now.Sub(asked) > wantTimeout {
+			delete(n.wanted, hash)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package node
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/signing"
+	"github.com/lapingvino/eolnpoc/transport"
+)
+
+// startNode starts a node on hub with a new key, closed when the test ends.
+func startNode(t *testing.T, hub *transport.MemoryHub, opts Options) *Node {
+	t.Helper()
+	key, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := hub.Connect()
+	opts.Transport = conn
+	opts.Key = key
+
+	n, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		n.Close()
+		conn.Close()
+	})
+	return n
+}
+
+// waitFor fails the test if cond does not become true within a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting until %s", what)
+}
+
+// neverHappens fails the test if cond becomes true within 100ms.
+func neverHappens(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(100 * time.Millisecond); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			t.Fatalf("unexpectedly %s", what)
+		}
+	}
+}
+
+func cached(n *Node, hash string) func() bool {
+	return func() bool {
+		_, ok := n.CachedMessage(hash)
+		return ok
+	}
+}
+
+func TestPublishReceive(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	a := startNode(t, hub, Options{})
+	b := startNode(t, hub, Options{})
+
+	hash, err := a.Publish("Hello #OLN from 6FG22222+22", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.CachedMessage(hash); !ok {
+		t.Error("published message not in own cache")
+	}
+	waitFor(t, "b has the message", cached(b, hash))
+
+	entry, ok := b.Entry(hash)
+	if !ok {
+		t.Fatal("no entry")
+	}
+	if entry.SigStatus != signing.Valid {
+		t.Errorf("signature %v, want valid", entry.SigStatus)
+	}
+	if entry.Message.Origin.PubKey != a.PubKey() {
+		t.Errorf("origin %s, want %s", entry.Message.Origin.PubKey, a.PubKey())
+	}
+
+	for _, q := range []SearchQuery{
+		{Mode: SearchTag, Query: "#oln"},
+		{Mode: SearchLocation, Query: "6FG22200+"},
+		{Query: "hello"},
+	} {
+		if results := b.Search(q); len(results) != 1 || results[0].Hash != hash {
+			t.Errorf("Search(%+v) = %d results", q, len(results))
+		}
+	}
+}
+
+func TestFilteredSubscriptions(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	a := startNode(t, hub, Options{})
+	b := startNode(t, hub, Options{Filters: Filters{Hashtags: []string{"#x"}}})
+
+	other, err := a.Publish("Not for b #y", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := a.Publish("For b #x", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "b has the #x message", cached(b, hash))
+	neverHappens(t, "b received a message outside its filters", cached(b, other))
+}
+
+// TestLocationFilterMatches checks that a location filter matches the
+// messages in its area, not only those spelling it out.
+func TestLocationFilterMatches(t *testing.T) {
+	n := startNode(t, transport.NewMemoryHub(), Options{Filters: Filters{Locations: []string{"6FG22200+"}}})
+
+	for text, want := range map[string]bool{
+		"Meet at 6FG22222+22":     true,
+		"Somewhere #geo6FG22200":  true,
+		"Elsewhere at 9F469VXG+2": false,
+	} {
+		hash, err := n.Publish(text, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, ok := n.Entry(hash)
+		if !ok {
+			t.Fatalf("%q not cached", text)
+		}
+		if got := n.MatchesFilters(&entry); got != want {
+			t.Errorf("MatchesFilters(%q) = %v, want %v", text, got, want)
+		}
+		if got := entry.Priority >= 1000; got != want {
+			t.Errorf("%q has priority %d, filter bonus %v, want %v", text, entry.Priority, got, want)
+		}
+	}
+}
+
+func TestMessageTags(t *testing.T) {
+	tags, indexKeys := MessageTags("Meet at 9G8F+6X #OLN", "8FVC9G00+")
+	if want := []string{"#OLN", "8FVC9G8F+6X"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags = %v, want %v", tags, want)
+	}
+	want := []string{"#OLN", "8FVC9G8F+6X", "8FVC9G8F+", "8FVC9G00+", "8FVC0000+", "8F000000+"}
+	if !reflect.DeepEqual(indexKeys, want) {
+		t.Errorf("index keys = %v, want %v", indexKeys, want)
+	}
+
+	if tags, _ := MessageTags("Meet at 9G8F+6X", ""); len(tags) != 0 {
+		t.Errorf("short code recovered without a reference: %v", tags)
+	}
+}
+
+func TestExpiredMessagesForgotten(t *testing.T) {
+	n := startNode(t, transport.NewMemoryHub(), Options{})
+	hash, err := n.Publish("Soon gone #expiring", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := n.Index.Lookup("#expiring"); len(refs) != 1 {
+		t.Fatalf("Lookup(#expiring) = %v", refs)
+	}
+
+	n.mu.Lock()
+	n.cache[hash].Message.Timestamp = time.Now().Add(-(ttlDays + 1) * 24 * time.Hour)
+	n.mu.Unlock()
+	n.cleanupExpired()
+
+	if _, ok := n.CachedMessage(hash); ok {
+		t.Error("expired message still cached")
+	}
+	if refs := n.Index.Lookup("#expiring"); len(refs) != 0 {
+		t.Errorf("expired message still indexed: %v", refs)
+	}
+}
+
+func TestFilteredNodeGetsEncrypted(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	a := startNode(t, hub, Options{})
+	b := startNode(t, hub, Options{Filters: Filters{Hashtags: []string{"#x"}}})
+
+	dm, err := a.PublishDirect(b.PubKey(), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "b has the direct message", cached(b, dm))
+	if entry, _ := b.Entry(dm); !entry.Private || entry.Text() != "secret" {
+		t.Errorf("direct message not decrypted: %+v", entry)
+	}
+
+	channel, _ := a.JoinChannel("room", "passphrase")
+	b.JoinChannel("room", "passphrase")
+	ch, err := a.PublishChannel(channel, "hello room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "b has the channel message", cached(b, ch))
+	if entry, _ := b.Entry(ch); entry.Channel != "room" || entry.Text() != "hello room" {
+		t.Errorf("channel message not decrypted: %+v", entry)
+	}
+}
+
+func TestDocumentsListFeeds(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	n := startNode(t, hub, Options{})
+
+	peer := hub.Connect()
+	defer peer.Close()
+	docs := make(chan *olnjson.Format, 1)
+	peer.Subscribe(MessageSubject, func(format *olnjson.Format) {
+		docs <- format
+	})
+	if _, err := n.Publish("Hello #feeds", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case format := <-docs:
+		data, err := json.Marshal(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{`"feeds":[]`, `"push":[]`} {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("document lacks %s: %s", want, data)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nothing published")
+	}
+}
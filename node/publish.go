@@ -0,0 +1,222 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/lapingvino/eolnpoc/location"
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/parser"
+	"github.com/lapingvino/eolnpoc/pow"
+	"github.com/lapingvino/eolnpoc/seal"
+	"github.com/lapingvino/eolnpoc/signing"
+)
+
+// Publish signs and publishes text as a public message and returns its
+// hash. With powBits above 0, or AutoPoWBits set, proof-of-work is computed
+// first, which can take a while.
+func (n *Node) Publish(messageText string, powBits int) (string, error) {
+	var finalMessage string
+
+	if powBits > 0 {
+		finalMessage = pow.CreatePoWMessage(powBits, "oln", messageText)
+	} else if n.AutoPoWBits > 0 {
+		finalMessage = pow.CreatePoWMessage(n.AutoPoWBits, "oln", messageText)
+	} else {
+		finalMessage = messageText
+	}
+
+	// PoW encodes the text, so parse the original
+	reference := ""
+	n.mu.RLock()
+	if len(n.filters.Locations) > 0 {
+		reference = n.filters.Locations[0]
+	}
+	n.mu.RUnlock()
+	tags, indexKeys := MessageTags(messageText, reference)
+
+	return n.sendMessage(finalMessage, tags, indexKeys)
+}
+
+// MessageTags returns the tags of a new message: every entity in text,
+// plus the short codes recovered relative to the plus code reference if it
+// is not empty. The index keys are the tags with plustags at every level of
+// their hierarchy.
+func MessageTags(text, reference string) (tags, indexKeys []string) {
+	tags = parser.Tags(text)
+	for _, plustag := range extractPlustags(text, reference) {
+		if !containsTag(tags, plustag) {
+			tags = append(tags, plustag)
+		}
+	}
+
+	for _, tag := range tags {
+		if location.ValidatePluscode(tag) {
+			indexKeys = append(indexKeys, location.GetParentPlustags(tag)...)
+		} else {
+			indexKeys = append(indexKeys, tag)
+		}
+	}
+	return tags, indexKeys
+}
+
+// PublishAt publishes text with the plus code of the given coordinates
+// appended.
+func (n *Node) PublishAt(lat, lng float64, text string) (string, error) {
+	return n.Publish(text+" "+location.Encode(lat, lng, 10), 0)
+}
+
+// PublishDirect sends text encrypted to the holder of pubKey.
+func (n *Node) PublishDirect(pubKey, text string) (string, error) {
+	recipient, err := signing.DecodePubKey(pubKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid recipient: %v", err)
+	}
+
+	sealed, err := seal.Direct(recipient, text)
+	if err != nil {
+		return "", fmt.Errorf("encrypting: %v", err)
+	}
+
+	// Tags and index would leak what the message is about, so leave them out
+	return n.sendMessage(sealed, nil, nil)
+}
+
+// PublishChannel sends text encrypted to a joined channel.
+func (n *Node) PublishChannel(channel *seal.Channel, text string) (string, error) {
+	sealed, err := channel.Seal(text)
+	if err != nil {
+		return "", fmt.Errorf("encrypting: %v", err)
+	}
+	return n.sendMessage(sealed, nil, nil)
+}
+
+// JoinChannel joins an encrypted channel and makes it the active one. It
+// returns the channel and the number of cached messages it decrypted.
+func (n *Node) JoinChannel(name, passphrase string) (*seal.Channel, int) {
+	channel := seal.NewChannel(name, passphrase)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.channels[name] = channel
+	n.activeChannel = channel
+
+	// Decrypt messages that arrived before we joined
+	decrypted := 0
+	for _, entry := range n.cache {
+		if !entry.Hidden() {
+			continue
+		}
+		if text, err := channel.Open(entry.Message.Raw); err == nil {
+			entry.Plaintext = text
+			entry.Channel = name
+			entry.Plustags = n.extractPlustags(text)
+			entry.ReplyTo = replyTargets(text)
+			decrypted++
+		}
+	}
+	if decrypted > 0 {
+		n.recalculatePriorities()
+	}
+
+	return channel, decrypted
+}
+
+// LeaveChannel leaves a channel, the active one if name is empty, and
+// returns its name. Its messages are hidden again.
+func (n *Node) LeaveChannel(name string) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if name == "" {
+		if n.activeChannel == nil {
+			return "", fmt.Errorf("not in a channel")
+		}
+		name = n.activeChannel.Name
+	}
+
+	if _, ok := n.channels[name]; !ok {
+		return "", fmt.Errorf("not in channel: %s", name)
+	}
+
+	delete(n.channels, name)
+	if n.activeChannel != nil && n.activeChannel.Name == name {
+		n.activeChannel = nil
+	}
+
+	// Hide the channel's messages again
+	for _, entry := range n.cache {
+		if entry.Channel == name {
+			entry.Plaintext = ""
+			entry.Channel = ""
+		}
+	}
+	return name, nil
+}
+
+// ActiveChannel returns the channel joined last, nil for public chat.
+func (n *Node) ActiveChannel() *seal.Channel {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.activeChannel
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// sendMessage signs raw as a new message from us, publishes it with the
+// given index keys pointing at it and returns its hash.
+func (n *Node) sendMessage(raw string, tags, indexKeys []string) (string, error) {
+	msg := olnjson.Message{
+		Raw:       raw,
+		Timestamp: olnjson.Now(),
+		TTL:       ttlDays,
+		Hops:      0,
+		Tags:      tags,
+		Origin:    n.Origin,
+	}
+	if msg.Origin.Display == "" {
+		msg.Origin.Display = "anonymous"
+	}
+
+	if err := signing.Sign(n.Key, &msg); err != nil {
+		return "", fmt.Errorf("signing: %v", err)
+	}
+
+	msgHash, err := multihash.Sum(msg)
+	if err != nil {
+		return "", fmt.Errorf("hashing: %v", err)
+	}
+
+	// Create format
+	format := olnjson.Format{
+		Server: n.ServerInfo(),
+		Messages: map[string]olnjson.Message{
+			msgHash: msg,
+		},
+		Index: make(map[string][]string),
+		Feeds: n.Feeds,
+		Push:  n.Push,
+	}
+
+	for _, key := range indexKeys {
+		format.Index[key] = append(format.Index[key], msgHash)
+	}
+
+	// Keep our own messages, even if our filters won't bring them back
+	n.AddMessage(msgHash, msg)
+
+	if err := PublishAll(n.Transport, &format, tags); err != nil {
+		return "", err
+	}
+	n.pushOutgoing(&format)
+
+	return msgHash, nil
+}
@@ -0,0 +1,108 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/feed"
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/signing"
+)
+
+// maxPushSize limits the body of a pushed document. Pushes carry new
+// messages, not whole feeds, so this is well below feed.DefaultMaxSize.
+const maxPushSize = 1 << 20
+
+// checkPushed validates a message pushed to us over HTTP. Pushed messages
+// go through the same checks as received ones, but forged signatures are
+// never accepted and the PoW threshold applies.
+func (n *Node) checkPushed(hash string, msg olnjson.Message) error {
+	if err := multihash.Verify(hash, msg); err != nil {
+		return err
+	}
+
+	status := signing.Check(msg)
+	if status == signing.Forged || !n.SigPolicy.Accepts(status) {
+		return fmt.Errorf("signature %s", status)
+	}
+
+	if msg.Hops >= maxHops {
+		return fmt.Errorf("too many hops: %d", msg.Hops)
+	}
+
+	if bits := DetectPoW(msg.Raw); bits < n.PushMinPoW {
+		return fmt.Errorf("proof of work %d bits, need %d", bits, n.PushMinPoW)
+	}
+
+	return nil
+}
+
+// handlePush accepts documents POSTed by peers and adds their messages to
+// the cache. It answers with a feed.PushResult.
+func (n *Node) handlePush(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if !n.AcceptPush {
+		http.Error(w, "this node does not accept pushes", http.StatusForbidden)
+		return
+	}
+
+	var format olnjson.Format
+	body := http.MaxBytesReader(w, r.Body, maxPushSize)
+	if err := json.NewDecoder(body).Decode(&format); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("document larger than %d bytes", maxPushSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid document: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := feed.PushResult{
+		Accepted: []string{},
+		Rejected: make(map[string]string),
+	}
+	for hash, msg := range format.Messages {
+		if err := n.checkPushed(hash, msg); err != nil {
+			result.Rejected[hash] = err.Error()
+			continue
+		}
+		if err := n.AddMessage(hash, msg); err != nil {
+			result.Rejected[hash] = err.Error()
+			continue
+		}
+		result.Accepted = append(result.Accepted, hash)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error writing push reply: %v", err)
+	}
+}
+
+// pushOutgoing sends a document with our own messages to every push
+// target in the background.
+func (n *Node) pushOutgoing(format *olnjson.Format) {
+	for _, url := range n.Push {
+		go func(url string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			result, err := n.pushClient.Push(ctx, url, format)
+			if err != nil {
+				log.Printf("Push to %s failed: %v", url, err)
+				return
+			}
+			for hash, reason := range result.Rejected {
+				log.Printf("Push to %s: %s rejected: %s", url, hash, reason)
+			}
+		}(url)
+	}
+}
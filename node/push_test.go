@@ -0,0 +1,104 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/feed"
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/signing"
+	"github.com/lapingvino/eolnpoc/transport"
+)
+
+// signedMessage returns a new message with text signed by a new key, and
+// its hash.
+func signedMessage(t *testing.T, text string, timestamp time.Time) (string, olnjson.Message) {
+	t.Helper()
+	key, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := olnjson.Message{
+		Raw:       text,
+		Timestamp: timestamp.Truncate(time.Millisecond),
+		TTL:       ttlDays,
+		Origin:    olnjson.Origin{Display: "tester"},
+	}
+	if err := signing.Sign(key, &msg); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := multihash.Sum(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash, msg
+}
+
+func push(t *testing.T, handler http.Handler, messages map[string]olnjson.Message) feed.PushResult {
+	t.Helper()
+	data, err := json.Marshal(olnjson.Format{Messages: messages})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("push: %d %s", w.Code, w.Body)
+	}
+
+	var result feed.PushResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestPushReasons(t *testing.T) {
+	n := startNode(t, transport.NewMemoryHub(), Options{AcceptPush: true})
+	handler := n.Handler()
+
+	fresh, freshMsg := signedMessage(t, "pushed", time.Now())
+	expired, expiredMsg := signedMessage(t, "old", time.Now().Add(-30*24*time.Hour))
+	forged, forgedMsg := signedMessage(t, "forged", time.Now())
+	forgedMsg.Raw = "changed"
+
+	result := push(t, handler, map[string]olnjson.Message{
+		fresh:   freshMsg,
+		expired: expiredMsg,
+		forged:  forgedMsg,
+	})
+	if len(result.Accepted) != 1 || result.Accepted[0] != fresh {
+		t.Errorf("accepted %v, want only %s", result.Accepted, fresh)
+	}
+	if reason := result.Rejected[expired]; reason != errExpired.Error() {
+		t.Errorf("expired message: %q", reason)
+	}
+	if _, ok := result.Rejected[forged]; !ok {
+		t.Error("forged message not rejected")
+	}
+
+	// Pushing it again is reported, not silently accepted
+	result = push(t, handler, map[string]olnjson.Message{fresh: freshMsg})
+	if len(result.Accepted) != 0 || result.Rejected[fresh] != errCached.Error() {
+		t.Errorf("pushed twice: accepted %v, rejected %v", result.Accepted, result.Rejected)
+	}
+}
+
+func TestFeedAllow(t *testing.T) {
+	for _, accept := range []bool{false, true} {
+		n := startNode(t, transport.NewMemoryHub(), Options{AcceptPush: accept})
+		w := httptest.NewRecorder()
+		n.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", nil))
+
+		allow := w.Header().Get("Allow")
+		if w.Code != http.StatusMethodNotAllowed || strings.Contains(allow, "POST") != accept {
+			t.Errorf("AcceptPush %v: %d, Allow %q", accept, w.Code, allow)
+		}
+	}
+}
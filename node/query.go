@@ -0,0 +1,118 @@
+package node
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/transport"
+)
+
+const (
+	DefaultQueryTimeout = 3 * time.Second
+	maxQueryResults     = 100
+)
+
+// NewInbox returns a fresh subject to receive replies on.
+func NewInbox() (string, error) {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return ReplyPrefix + hex.EncodeToString(b[:]), nil
+}
+
+// SendQuery publishes q on the query subject and calls onReply for every
+// reply received within timeout. It blocks until the timeout has passed;
+// onReply is not called after it returns.
+func SendQuery(t transport.Transport, server olnjson.ServerInfo, q olnjson.Query, timeout time.Duration, onReply func(*olnjson.Format)) error {
+	inbox, err := NewInbox()
+	if err != nil {
+		return err
+	}
+	q.ReplyTo = inbox
+
+	var mu sync.Mutex
+	done := false
+	sub, err := t.Subscribe(q.ReplyTo, func(format *olnjson.Format) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !done {
+			onReply(format)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	defer func() {
+		mu.Lock()
+		done = true
+		mu.Unlock()
+	}()
+
+	request := olnjson.Format{
+		Server:   server,
+		Messages: map[string]olnjson.Message{},
+		Index:    map[string][]string{},
+		Feeds:    []string{},
+		Push:     []string{},
+		Query:    &q,
+	}
+	if err := t.Publish(QuerySubject, &request); err != nil {
+		return err
+	}
+
+	time.Sleep(timeout)
+	return nil
+}
+
+// answerQuery answers queries from other nodes with matching messages
+// from the cache.
+func (n *Node) answerQuery(request *olnjson.Format) {
+	query := request.Query
+	if query == nil || !strings.HasPrefix(query.ReplyTo, ReplyPrefix) {
+		return
+	}
+	// Our own queries are answered by the others
+	if request.Server.PubKey == n.PubKey() {
+		return
+	}
+
+	q, err := NewFeedQuery(query.Tags, query.Plustag, query.Origin, query.Since)
+	if err != nil {
+		return
+	}
+	q.Hashes = query.Hashes
+	q.Limit = maxQueryResults
+	if query.Limit > 0 && query.Limit < maxQueryResults {
+		q.Limit = query.Limit
+	}
+
+	reply := n.FeedFormat(q)
+	if len(reply.Messages) == 0 {
+		return
+	}
+	if err := n.Transport.Publish(query.ReplyTo, &reply); err != nil {
+		log.Printf("Failed to answer query: %v", err)
+	}
+}
+
+// Fetch asks the other nodes for messages and adds the replies to the
+// cache. It blocks until timeout has passed and returns the number of
+// messages added and of nodes that replied.
+func (n *Node) Fetch(q olnjson.Query, timeout time.Duration) (fresh, replies int, err error) {
+	err = SendQuery(n.Transport, n.ServerInfo(), q, timeout, func(format *olnjson.Format) {
+		replies++
+		for hash, msg := range format.Messages {
+			if n.AddMessage(hash, msg) == nil {
+				fresh++
+			}
+		}
+	})
+	return fresh, replies, err
+}
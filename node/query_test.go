@@ -0,0 +1,52 @@
+package node
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/transport"
+)
+
+// TestSendQueryStopsReplies checks that replies arriving after SendQuery
+// returned are not handed to onReply, which its caller no longer guards.
+func TestSendQueryStopsReplies(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	responder := hub.Connect()
+	defer responder.Close()
+	late := make(chan bool)
+	responder.Subscribe(QuerySubject, func(request *olnjson.Format) {
+		reply := &olnjson.Format{Messages: make(map[string]olnjson.Message)}
+		responder.Publish(request.Query.ReplyTo, reply)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			responder.Publish(request.Query.ReplyTo, reply)
+			close(late)
+		}()
+	})
+
+	conn := hub.Connect()
+	defer conn.Close()
+	var returned atomic.Bool
+	var replies, after atomic.Int32
+	err := SendQuery(conn, olnjson.ServerInfo{}, olnjson.Query{}, 20*time.Millisecond, func(*olnjson.Format) {
+		replies.Add(1)
+		if returned.Load() {
+			after.Add(1)
+		}
+	})
+	returned.Store(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-late
+	time.Sleep(20 * time.Millisecond)
+	if replies.Load() == 0 {
+		t.Error("no reply received within the timeout")
+	}
+	if n := after.Load(); n != 0 {
+		t.Errorf("onReply called %d times after SendQuery returned", n)
+	}
+}
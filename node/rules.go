@@ -0,0 +1,303 @@
+package node
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/parser"
+	"github.com/lapingvino/eolnpoc/signing"
+)
+
+// Rules keep messages out of sight, where Filters only raise their
+// priority. Messages matching a rule are still cached and passed on, but
+// not shown, listed or found, so they show up again when the rule goes.
+type Rules struct {
+	MutedTags      []string // Tags, matched case-insensitively
+	BlockedOrigins []string // Public keys or display names
+	Words          []string // Regular expressions matched against the text, case-insensitive
+	UnknownMinPoW  int      // PoW bits required from senders we neither follow nor trust
+}
+
+func (r Rules) clone() Rules {
+	return Rules{
+		MutedTags:      append([]string(nil), r.MutedTags...),
+		BlockedOrigins: append([]string(nil), r.BlockedOrigins...),
+		Words:          append([]string(nil), r.Words...),
+		UnknownMinPoW:  r.UnknownMinPoW,
+	}
+}
+
+// Empty reports whether no rules are set.
+func (r Rules) Empty() bool {
+	return len(r.MutedTags) == 0 && len(r.BlockedOrigins) == 0 && len(r.Words) == 0 && r.UnknownMinPoW == 0
+}
+
+// compileWord compiles a word filter.
+func compileWord(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid word filter %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// ParseRules reads rules, one per line:
+//
+//	mute #tag...
+//	block <pubkey or display name>
+//	word <regular expression>
+//	min-pow <bits>
+//
+// Empty lines and lines starting with # are skipped. Muted words without
+// a # or @ are taken as hashtags.
+func ParseRules(r io.Reader) (Rules, error) {
+	var rules Rules
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		kind, value, _ := strings.Cut(text, " ")
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return rules, fmt.Errorf("line %d: %s needs a value", line, kind)
+		}
+
+		switch kind {
+		case "mute":
+			for _, tag := range strings.Fields(value) {
+				rules.MutedTags = append(rules.MutedTags, mutedTag(tag))
+			}
+		case "block":
+			rules.BlockedOrigins = append(rules.BlockedOrigins, value)
+		case "word":
+			if _, err := compileWord(value); err != nil {
+				return rules, fmt.Errorf("line %d: %v", line, err)
+			}
+			rules.Words = append(rules.Words, value)
+		case "min-pow":
+			bits, err := strconv.Atoi(value)
+			if err != nil || bits < 0 {
+				return rules, fmt.Errorf("line %d: invalid PoW bits: %s", line, value)
+			}
+			rules.UnknownMinPoW = bits
+		default:
+			return rules, fmt.Errorf("line %d: unknown rule: %s", line, kind)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// LoadRules reads a rules file, see ParseRules.
+func LoadRules(path string) (Rules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Rules{}, err
+	}
+	defer f.Close()
+	return ParseRules(f)
+}
+
+// Rules returns a copy of the current rules.
+func (n *Node) Rules() Rules {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.rules.clone()
+}
+
+// SetRules replaces the rules.
+func (n *Node) SetRules(rules Rules) error {
+	words := make([]*regexp.Regexp, 0, len(rules.Words))
+	for _, pattern := range rules.Words {
+		re, err := compileWord(pattern)
+		if err != nil {
+			return err
+		}
+		words = append(words, re)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.rules = rules.clone()
+	n.words = words
+	return nil
+}
+
+// MuteTags adds tags to mute and returns those that were not muted yet.
+func (n *Node) MuteTags(tags ...string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var added []string
+	for _, tag := range tags {
+		tag = mutedTag(strings.TrimSpace(tag))
+		if tag != "" && !containsFold(n.rules.MutedTags, tag) {
+			n.rules.MutedTags = append(n.rules.MutedTags, tag)
+			added = append(added, tag)
+		}
+	}
+	return added
+}
+
+// UnmuteTag unmutes a tag and reports whether it was muted.
+func (n *Node) UnmuteTag(tag string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return removeFold(&n.rules.MutedTags, mutedTag(tag))
+}
+
+// mutedTag makes a plain word a hashtag; other tags are kept as they are.
+func mutedTag(tag string) string {
+	if tag == "" || strings.HasPrefix(tag, "#") || strings.HasPrefix(tag, "@") || strings.ContainsAny(tag, ":+/") {
+		return tag
+	}
+	return "#" + tag
+}
+
+// BlockOrigin blocks a public key or display name and reports whether it
+// was not blocked yet.
+func (n *Node) BlockOrigin(origin string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if containsTag(n.rules.BlockedOrigins, origin) {
+		return false
+	}
+	n.rules.BlockedOrigins = append(n.rules.BlockedOrigins, origin)
+	return true
+}
+
+// UnblockOrigin unblocks a public key or display name and reports whether
+// it was blocked.
+func (n *Node) UnblockOrigin(origin string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i, o := range n.rules.BlockedOrigins {
+		if o == origin {
+			n.rules.BlockedOrigins = append(n.rules.BlockedOrigins[:i], n.rules.BlockedOrigins[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AddWordFilter hides messages whose text matches pattern.
+func (n *Node) AddWordFilter(pattern string) error {
+	re, err := compileWord(pattern)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !containsTag(n.rules.Words, pattern) {
+		n.rules.Words = append(n.rules.Words, pattern)
+		n.words = append(n.words, re)
+	}
+	return nil
+}
+
+// RemoveWordFilter removes a word filter and reports whether it was set.
+func (n *Node) RemoveWordFilter(pattern string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i, p := range n.rules.Words {
+		if p == pattern {
+			n.rules.Words = append(n.rules.Words[:i], n.rules.Words[i+1:]...)
+			n.words = append(n.words[:i], n.words[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SetUnknownMinPoW sets the PoW bits required from unknown senders, 0 for
+// none.
+func (n *Node) SetUnknownMinPoW(bits int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.rules.UnknownMinPoW = bits
+}
+
+// Rejects reports whether the rules keep an entry out of sight.
+func (n *Node) Rejects(entry MessageEntry) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.rejects(&entry)
+}
+
+// rejects reports whether the rules, or a block in the contact list, keep
+// an entry out of sight. Callers must hold n.mu.
+func (n *Node) rejects(entry *MessageEntry) bool {
+	origin := entry.Message.Origin
+	verified := entry.SigStatus == signing.Valid
+
+	for _, blocked := range n.rules.BlockedOrigins {
+		if blocked == origin.PubKey || blocked == origin.Display {
+			return true
+		}
+	}
+	if verified && n.Contacts.Score(origin.PubKey) < 0 {
+		return true
+	}
+
+	if n.rules.UnknownMinPoW > 0 && entry.PoWBits < n.rules.UnknownMinPoW {
+		known := verified && (origin.PubKey == n.PubKey() || n.Contacts.Follows(origin.PubKey) || n.Contacts.Score(origin.PubKey) > 0)
+		if !known {
+			return true
+		}
+	}
+
+	if entry.Hidden() {
+		return false
+	}
+	text := entry.Text()
+
+	if len(n.rules.MutedTags) > 0 {
+		for _, tag := range append(parser.Tags(text), entry.Message.Tags...) {
+			if containsFold(n.rules.MutedTags, tag) {
+				return true
+			}
+		}
+	}
+
+	for _, re := range n.words {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// shown reports whether an entry is shown: it can be read and no rule
+// keeps it out. Callers must hold n.mu.
+func (n *Node) shown(entry *MessageEntry) bool {
+	return !entry.Hidden() && !n.rejects(entry)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFold(list *[]string, s string) bool {
+	for i, item := range *list {
+		if strings.EqualFold(item, s) {
+			*list = append((*list)[:i], (*list)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package node
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lapingvino/eolnpoc/transport"
+)
+
+func TestOwnMessagesPassMinPoW(t *testing.T) {
+	n := startNode(t, transport.NewMemoryHub(), Options{Rules: Rules{UnknownMinPoW: 4}})
+	hash, err := n.Publish("hello #x", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := n.CachedMessage(hash); !ok {
+		t.Fatal("own message not cached")
+	}
+	if results := n.Search(SearchQuery{Mode: SearchTag, Query: "#x"}); len(results) != 1 {
+		t.Errorf("own message not shown: %d results", len(results))
+	}
+}
+
+// TestRulesHide checks that messages matching rules are cached but hidden,
+// and show up again when the rule is removed.
+func TestRulesHide(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	a := startNode(t, hub, Options{})
+	b := startNode(t, hub, Options{Rules: Rules{UnknownMinPoW: 4}})
+	b.MuteTags("spam")
+	b.BlockOrigin(a.PubKey())
+
+	hash, err := a.Publish("Buy now #spam", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "b caches the message", cached(b, hash))
+
+	q := SearchQuery{Mode: SearchTag, Query: "#spam"}
+	if results := b.Search(q); len(results) != 0 {
+		t.Fatalf("message matching rules shown: %d results", len(results))
+	}
+	if _, ok := b.FindEntry(hash[:12]); ok {
+		t.Error("message matching rules found by prefix")
+	}
+	if thread, _ := b.Thread(hash); thread.Entry != nil {
+		t.Error("message matching rules shown in its thread")
+	}
+
+	// Lifting one rule after the other shows it again
+	b.UnmuteTag("#spam")
+	b.UnblockOrigin(a.PubKey())
+	if results := b.Search(q); len(results) != 0 {
+		t.Fatal("message without proof of work from an unknown sender shown")
+	}
+	b.SetUnknownMinPoW(0)
+	if results := b.Search(q); len(results) != 1 || results[0].Hash != hash {
+		t.Errorf("message not shown after removing the rules: %d results", len(results))
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# Comment
+mute spam #ads @someone
+block Alice Smith
+word (?i)buy\s+now
+min-pow 8
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Rules{
+		MutedTags:      []string{"#spam", "#ads", "@someone"},
+		BlockedOrigins: []string{"Alice Smith"},
+		Words:          []string{`(?i)buy\s+now`},
+		UnknownMinPoW:  8,
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("ParseRules = %+v, want %+v", rules, want)
+	}
+
+	for _, text := range []string{"mute", "word (", "min-pow -1", "min-pow x", "hide #x"} {
+		if _, err := ParseRules(strings.NewReader(text)); err == nil {
+			t.Errorf("ParseRules(%q) succeeded", text)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package node
+
+import (
+	"time"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+const (
+	// Remember at most this many messages. Past it, arbitrary entries are
+	// forgotten to make room.
+	maxSeen = 100000
+
+	// Once more copies than this of already seen messages of one origin
+	// arrive within dampWindow, further copies are dropped unchecked for
+	// the rest of the window.
+	maxOriginDuplicates = 200
+	dampWindow          = time.Minute
+)
+
+// seenMessage is what is remembered of a received message.
+type seenMessage struct {
+	Expires time.Time // End of the message's TTL
+	Hops    int       // Fewest hops it arrived with
+	Origin  string    // Public key of the author, or the hash if unsigned
+}
+
+// originStats counts the copies of an origin's messages that arrived again
+// in the current window.
+type originStats struct {
+	Start      time.Time
+	Duplicates int
+}
+
+// seenSet remembers every accepted message until its TTL ends, whether or
+// not it is still cached, so evicted and cleared messages are not taken in
+// again when peers send them back. It is guarded by Node.mu.
+type seenSet struct {
+	messages map[string]*seenMessage
+	origins  map[string]*originStats // By seenMessage.Origin
+}
+
+func newSeenSet() *seenSet {
+	return &seenSet{
+		messages: make(map[string]*seenMessage),
+		origins:  make(map[string]*originStats),
+	}
+}
+
+// has reports whether the message was seen.
+func (s *seenSet) has(hash string) bool {
+	_, ok := s.messages[hash]
+	return ok
+}
+
+// add records a verified message, keeping the lowest hop count it arrived
+// with.
+func (s *seenSet) add(hash string, msg olnjson.Message) {
+	if seen, ok := s.messages[hash]; ok {
+		if msg.Hops < seen.Hops {
+			seen.Hops = msg.Hops
+		}
+		return
+	}
+
+	if len(s.messages) >= maxSeen {
+		for old := range s.messages {
+			delete(s.messages, old)
+			break
+		}
+	}
+	origin := msg.Origin.PubKey
+	if origin == "" {
+		origin = hash
+	}
+	s.messages[hash] = &seenMessage{
+		Expires: msg.Timestamp.Add(time.Duration(msg.TTL) * 24 * time.Hour),
+		Hops:    msg.Hops,
+		Origin:  origin,
+	}
+}
+
+// hashes returns all seen hashes.
+func (s *seenSet) hashes() []string {
+	result := make([]string, 0, len(s.messages))
+	for hash := range s.messages {
+		result = append(result, hash)
+	}
+	return result
+}
+
+// damp counts a copy of a seen message against the origin we recorded for
+// it and reports whether the origin's messages arrived again too often
+// lately. Such copies can be dropped unchecked, which damps rebroadcast
+// storms. The origin comes from our own verified copy, so senders cannot
+// pin their copies on someone else; messages not seen yet are never damped.
+func (s *seenSet) damp(hash string, now time.Time) bool {
+	seen, ok := s.messages[hash]
+	if !ok {
+		return false
+	}
+
+	stats, ok := s.origins[seen.Origin]
+	if !ok || now.Sub(stats.Start) > dampWindow {
+		stats = &originStats{Start: now}
+		s.origins[seen.Origin] = stats
+	}
+	stats.Duplicates++
+	return stats.Duplicates > maxOriginDuplicates
+}
+
+// expire forgets messages past their TTL and finished damping windows.
+func (s *seenSet) expire(now time.Time) {
+	for hash, seen := range s.messages {
+		if now.After(seen.Expires) {
+			delete(s.messages, hash)
+		}
+	}
+	for origin, stats := range s.origins {
+		if now.Sub(stats.Start) > dampWindow {
+			delete(s.origins, origin)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/transport"
+)
+
+func TestDampByOrigin(t *testing.T) {
+	now := time.Now()
+	s := newSeenSet()
+	stormHash, storm := signedMessage(t, "Storm", now)
+	quietHash, quiet := signedMessage(t, "Quiet", now)
+	s.add(stormHash, storm)
+	s.add(quietHash, quiet)
+
+	for i := 0; i < maxOriginDuplicates; i++ {
+		if s.damp(stormHash, now) {
+			t.Fatalf("damped after %d copies", i+1)
+		}
+	}
+	if !s.damp(stormHash, now) {
+		t.Error("storm not damped")
+	}
+	if s.damp(quietHash, now) {
+		t.Error("another origin damped")
+	}
+	if s.damp("QmNotSeen", now) {
+		t.Error("message not seen yet damped")
+	}
+	if s.damp(stormHash, now.Add(dampWindow+time.Second)) {
+		t.Error("still damped after the window")
+	}
+}
+
+func TestDampUnsignedByHash(t *testing.T) {
+	now := time.Now()
+	s := newSeenSet()
+	aHash, a := signedMessage(t, "A", now)
+	bHash, b := signedMessage(t, "B", now)
+	a.Origin.PubKey, a.Sig = "", ""
+	b.Origin.PubKey, b.Sig = "", ""
+	s.add(aHash, a)
+	s.add(bHash, b)
+
+	for i := 0; i <= maxOriginDuplicates; i++ {
+		s.damp(aHash, now)
+	}
+	if s.damp(bHash, now) {
+		t.Error("unsigned messages share a damping bucket")
+	}
+}
+
+// TestCopiesVerifiedFirst checks that copies whose hash does not match
+// change nothing about the message.
+func TestCopiesVerifiedFirst(t *testing.T) {
+	n := startNode(t, transport.NewMemoryHub(), Options{})
+	hash, msg := signedMessage(t, "Original #copy", time.Now())
+	msg.Hops = 2
+	if err := n.AddMessage(hash, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	forged := msg
+	forged.Raw = "Forged #copy"
+	forged.Hops = 0
+	forged.TTL = 365
+	if err := n.AddMessage(hash, forged); err == nil {
+		t.Fatal("forged copy accepted")
+	}
+	if entry, _ := n.Entry(hash); entry.Message.Hops != 2 {
+		t.Errorf("forged copy lowered hops to %d", entry.Message.Hops)
+	}
+
+	// Evicted or cleared, only the seen set remembers it
+	n.mu.Lock()
+	delete(n.cache, hash)
+	n.mu.Unlock()
+	if err := n.AddMessage(hash, forged); err == nil || err == errSeen {
+		t.Fatalf("forged copy of a seen message: %v", err)
+	}
+	n.mu.RLock()
+	seen := *n.seen.messages[hash]
+	n.mu.RUnlock()
+	if seen.Hops != 2 || seen.Expires != msg.Timestamp.Add(ttlDays*24*time.Hour) {
+		t.Errorf("forged copy changed the seen set: %+v", seen)
+	}
+}
+
+// TestClearCacheForgets checks that cleared messages leave the index but
+// stay seen.
+func TestClearCacheForgets(t *testing.T) {
+	n := startNode(t, transport.NewMemoryHub(), Options{})
+	hash, err := n.Publish("Cleared #clear", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := n.Index.Lookup("#clear"); len(refs) != 1 {
+		t.Fatalf("Lookup(#clear) = %v before clearing", refs)
+	}
+
+	if got := n.ClearCache(); got != 1 {
+		t.Errorf("ClearCache() = %d, want 1", got)
+	}
+	if refs := n.Index.Lookup("#clear"); len(refs) != 0 {
+		t.Errorf("Lookup(#clear) = %v after clearing", refs)
+	}
+	n.mu.RLock()
+	_, seen := n.seen.messages[hash]
+	n.mu.RUnlock()
+	if !seen {
+		t.Error("cleared message no longer seen")
+	}
+}
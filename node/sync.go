@@ -0,0 +1,229 @@
+package node
+
+import (
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/location"
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/seal"
+)
+
+const (
+	// A missing message is asked from one peer at a time. If it has not
+	// arrived after this long, the next offer may ask another.
+	wantTimeout = 30 * time.Second
+
+	// Offers and wants list at most this many hashes
+	maxSyncHashes = 1000
+)
+
+// syncLoop periodically publishes a summary of the cache. Together with
+// answering the summaries of others, this reconciles the cache with the
+// other nodes, so only messages that are missing somewhere travel over the
+// network.
+func (n *Node) syncLoop() {
+	ticker := time.NewTicker(n.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stopChan:
+			return
+		case <-ticker.C:
+			n.sendSummary()
+		}
+	}
+}
+
+// sendSummary publishes a Bloom filter of all messages we have seen
+// together with our filters. Evicted messages are in it too, so they are
+// not offered back to us.
+func (n *Node) sendSummary() {
+	n.mu.RLock()
+	summary := olnjson.Sync{
+		Filter:  olnjson.NewFilter(rand.Uint32(), n.seen.hashes()),
+		Tags:    append([]string(nil), n.filters.Hashtags...),
+		ReplyTo: n.inbox,
+	}
+	for _, code := range n.filters.Locations {
+		code = strings.ToUpper(code)
+		if location.ValidatePluscode(code) {
+			summary.Plustags = append(summary.Plustags, code)
+		}
+	}
+	n.mu.RUnlock()
+
+	if err := n.sendSync(SyncSubject, &summary, nil); err != nil {
+		log.Printf("Failed to publish sync summary: %v", err)
+	}
+}
+
+// answerSummary offers the sender of a summary the messages it is missing
+// and wants.
+func (n *Node) answerSummary(format *olnjson.Format) {
+	summary := format.Sync
+	if summary == nil || summary.ReplyTo == n.inbox || !strings.HasPrefix(summary.ReplyTo, ReplyPrefix) {
+		return
+	}
+
+	have := make(map[string]bool, len(summary.Have))
+	for _, hash := range summary.Have {
+		have[hash] = true
+	}
+	has := func(hash string) bool {
+		return have[hash] || summary.Filter != nil && summary.Filter.Has(hash)
+	}
+
+	now := time.Now()
+	var offer []string
+	n.mu.RLock()
+	for hash, entry := range n.cache {
+		if len(offer) == maxSyncHashes {
+			break
+		}
+		if !has(hash) && shareable(entry, now) && wantedBy(summary, entry) {
+			offer = append(offer, hash)
+		}
+	}
+	n.mu.RUnlock()
+
+	if len(offer) == 0 {
+		return
+	}
+	if err := n.sendSync(summary.ReplyTo, &olnjson.Sync{Have: offer, ReplyTo: n.inbox}, nil); err != nil {
+		log.Printf("Failed to send sync offer: %v", err)
+	}
+}
+
+// handleSyncReply handles what arrives on our inbox: messages we asked
+// for, offers of messages we are missing and requests for our messages.
+func (n *Node) handleSyncReply(format *olnjson.Format) {
+	n.Receive(format)
+
+	reply := format.Sync
+	if reply == nil || !strings.HasPrefix(reply.ReplyTo, ReplyPrefix) {
+		return
+	}
+	if len(reply.Have) > 0 {
+		n.requestOffered(reply)
+	}
+	if len(reply.Want) > 0 {
+		n.sendWanted(reply)
+	}
+}
+
+// requestOffered asks for the offered messages we don't have and haven't
+// asked another peer for already.
+func (n *Node) requestOffered(offer *olnjson.Sync) {
+	now := time.Now()
+	var want []string
+
+	n.mu.Lock()
+	for _, hash := range offer.Have {
+		if len(want) == maxSyncHashes {
+			break
+		}
+		if n.seen.has(hash) {
+			continue
+		}
+		if asked, ok := n.wanted[hash]; ok && now.Sub(asked) < wantTimeout {
+			continue
+		}
+		n.wanted[hash] = now
+		want = append(want, hash)
+	}
+	n.mu.Unlock()
+
+	if len(want) == 0 {
+		return
+	}
+	if err := n.sendSync(offer.ReplyTo, &olnjson.Sync{Want: want, ReplyTo: n.inbox}, nil); err != nil {
+		log.Printf("Failed to request offered messages: %v", err)
+	}
+}
+
+// sendWanted sends the requested messages, counting the hop.
+func (n *Node) sendWanted(request *olnjson.Sync) {
+	now := time.Now()
+	messages := make(map[string]olnjson.Message)
+
+	n.mu.Lock()
+	for _, hash := range request.Want {
+		entry, ok := n.cache[hash]
+		if !ok || !shareable(entry, now) {
+			continue
+		}
+		msg := entry.Message
+		msg.Hops++
+		entry.LastSent = now
+		messages[hash] = msg
+	}
+	n.mu.Unlock()
+
+	if len(messages) == 0 {
+		return
+	}
+	if err := n.sendSync(request.ReplyTo, nil, messages); err != nil {
+		log.Printf("Failed to send wanted messages: %v", err)
+	}
+}
+
+// sendSync publishes a document with sync data and messages on subject.
+func (n *Node) sendSync(subject string, sync *olnjson.Sync, messages map[string]olnjson.Message) error {
+	if messages == nil {
+		messages = make(map[string]olnjson.Message)
+	}
+	format := olnjson.Format{
+		Server:   n.ServerInfo(),
+		Messages: messages,
+		Index:    make(map[string][]string),
+		Feeds:    n.Feeds,
+		Push:     n.Push,
+		Sync:     sync,
+	}
+	return n.Transport.Publish(subject, &format)
+}
+
+// shareable reports whether a cached message may still be passed on: it
+// has hops left and more than half of its TTL remaining.
+func shareable(entry *MessageEntry, now time.Time) bool {
+	msg := entry.Message
+	if msg.Hops >= maxHops {
+		return false
+	}
+	ttlDuration := time.Duration(msg.TTL) * 24 * time.Hour
+	return now.Sub(msg.Timestamp) <= ttlDuration/2
+}
+
+// wantedBy reports whether an entry passes the filters of a summary.
+// Encrypted messages are wanted by everyone, like on SealedSubject.
+func wantedBy(summary *olnjson.Sync, entry *MessageEntry) bool {
+	if len(summary.Tags) == 0 && len(summary.Plustags) == 0 {
+		return true
+	}
+	if seal.IsEncrypted(entry.Message.Raw) {
+		return true
+	}
+
+	for _, tag := range entry.Message.Tags {
+		for _, want := range summary.Tags {
+			if strings.EqualFold(tag, want) {
+				return true
+			}
+		}
+	}
+
+	// Messages of larger areas too, which filtered subscriptions miss
+	for _, plustag := range publicPlustags(entry) {
+		for _, want := range summary.Plustags {
+			if location.IsLocationMatch(plustag, want) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
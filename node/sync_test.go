@@ -0,0 +1,78 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/transport"
+)
+
+func TestSyncFetchesMissing(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	a := startNode(t, hub, Options{})
+
+	// Published before b joins, so b only gets it by syncing
+	hash, err := a.Publish("Before b #sync", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := startNode(t, hub, Options{})
+	b.sendSummary()
+	waitFor(t, "b synced the message", cached(b, hash))
+}
+
+// TestSyncOffersWhatFilterLacks checks that a summary's filter keeps the
+// messages in it from being offered.
+func TestSyncOffersWhatFilterLacks(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	a := startNode(t, hub, Options{})
+	had, err := a.Publish("Had #sync", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := a.Publish("Missing #sync", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peer := hub.Connect()
+	defer peer.Close()
+	offers := make(chan *olnjson.Sync, 1)
+	inbox := ReplyPrefix + "test"
+	peer.Subscribe(inbox, func(format *olnjson.Format) {
+		offers <- format.Sync
+	})
+	peer.Publish(SyncSubject, &olnjson.Format{
+		Messages: make(map[string]olnjson.Message),
+		Sync: &olnjson.Sync{
+			Filter:  olnjson.NewFilter(1, []string{had}),
+			ReplyTo: inbox,
+		},
+	})
+
+	select {
+	case offer := <-offers:
+		if len(offer.Have) != 1 || offer.Have[0] != missing {
+			t.Errorf("offered %v, want only %s", offer.Have, missing)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no offer")
+	}
+}
+
+// TestSyncLargerArea checks that messages of an area containing a location
+// filter, which its subscriptions miss, come with sync.
+func TestSyncLargerArea(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	a := startNode(t, hub, Options{})
+	b := startNode(t, hub, Options{Filters: Filters{Locations: []string{"6FG22200+"}}})
+
+	hash, err := a.Publish("Area news for 6FG20000+", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	neverHappens(t, "b received a larger area live", cached(b, hash))
+	b.sendSummary()
+	waitFor(t, "b synced the larger area", cached(b, hash))
+}
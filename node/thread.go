@@ -0,0 +1,166 @@
+package node
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/parser"
+	"github.com/lapingvino/eolnpoc/seal"
+)
+
+// A thread is fetched one missing ancestor at a time, this many at most.
+const maxThreadFetches = 10
+
+// Thread is a message with the replies to it that are cached.
+type Thread struct {
+	Hash    string
+	Entry   *MessageEntry // nil if the message is not cached or not shown
+	Replies []*Thread     // Oldest first
+}
+
+// replyTargets returns the message hashes mentioned in text, which make a
+// message a reply to them.
+func replyTargets(text string) []string {
+	var hashes []string
+	for _, e := range parser.Parse(text) {
+		if e.IsHash() && !containsTag(hashes, e.Value) {
+			hashes = append(hashes, e.Value)
+		}
+	}
+	return hashes
+}
+
+// Reply publishes text as a reply to the cached message parent by
+// mentioning its hash. Replies to channel and direct messages stay
+// private: they go to the same channel or back to the sender.
+func (n *Node) Reply(parent, text string) (string, error) {
+	n.mu.RLock()
+	entry, ok := n.cache[parent]
+	var hidden, private bool
+	var channel *seal.Channel
+	var origin string
+	if ok {
+		hidden, private = entry.Hidden(), entry.Private
+		channel = n.channels[entry.Channel]
+		origin = entry.Message.Origin.PubKey
+	}
+	n.mu.RUnlock()
+
+	if !ok || hidden {
+		return "", fmt.Errorf("message not cached: %s", parent)
+	}
+
+	text = "@" + parent + " " + text
+	if channel != nil {
+		return n.PublishChannel(channel, text)
+	}
+	if private {
+		return n.PublishDirect(origin, text)
+	}
+	return n.Publish(text, 0)
+}
+
+// Thread returns the conversation hash is part of, from the oldest message
+// it goes back to. If that message is not cached or not shown, its Entry
+// is nil and missing is its hash; FetchThread can ask other nodes for it.
+func (n *Node) Thread(hash string) (root *Thread, missing string) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	visible := func(hash string) (*MessageEntry, bool) {
+		entry, ok := n.cache[hash]
+		if !ok || !n.shown(entry) {
+			return nil, false
+		}
+		return entry, true
+	}
+
+	// Walk up to the first message
+	top := hash
+	visited := map[string]bool{top: true}
+	for {
+		entry, ok := visible(top)
+		if !ok {
+			missing = top
+			break
+		}
+		if len(entry.ReplyTo) == 0 || visited[entry.ReplyTo[0]] {
+			break
+		}
+		top = entry.ReplyTo[0]
+		visited[top] = true
+	}
+
+	replies := make(map[string][]*MessageEntry)
+	for _, entry := range n.cache {
+		if !n.shown(entry) {
+			continue
+		}
+		for _, parent := range entry.ReplyTo {
+			replies[parent] = append(replies[parent], entry)
+		}
+	}
+
+	// Walk down, each message only once in case of replies to several
+	// messages of the same thread
+	visited = make(map[string]bool)
+	var build func(hash string) *Thread
+	build = func(hash string) *Thread {
+		visited[hash] = true
+		t := &Thread{Hash: hash}
+		if entry, ok := visible(hash); ok {
+			copied := *entry
+			t.Entry = &copied
+		}
+
+		children := replies[hash]
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].Message.Timestamp.Before(children[j].Message.Timestamp)
+		})
+		for _, child := range children {
+			if !visited[child.Hash] {
+				t.Replies = append(t.Replies, build(child.Hash))
+			}
+		}
+		return t
+	}
+
+	return build(top), missing
+}
+
+// FetchThread returns the thread of hash like Thread, after asking the
+// other nodes for the messages it goes back to that are not cached. Every
+// missing message takes up to timeout to arrive. Messages that are cached
+// but not shown, because they can't be decrypted or a rule keeps them out,
+// are not asked for.
+func (n *Node) FetchThread(hash string, timeout time.Duration) (*Thread, error) {
+	for i := 0; i < maxThreadFetches; i++ {
+		_, missing := n.Thread(hash)
+		if missing == "" {
+			break
+		}
+
+		// Also take it in if it was evicted before
+		n.mu.Lock()
+		_, hidden := n.cache[missing]
+		if !hidden {
+			n.wanted[missing] = time.Now()
+		}
+		n.mu.Unlock()
+		if hidden {
+			break
+		}
+
+		if _, _, err := n.Fetch(olnjson.Query{Hashes: []string{missing}, Limit: 1}, timeout); err != nil {
+			return nil, err
+		}
+		if _, ok := n.CachedMessage(missing); !ok {
+			break
+		}
+	}
+
+	root, _ := n.Thread(hash)
+	return root, nil
+}
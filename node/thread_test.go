@@ -0,0 +1,107 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/seal"
+	"github.com/lapingvino/eolnpoc/transport"
+)
+
+func TestFetchThread(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	a := startNode(t, hub, Options{})
+
+	root, err := a.Publish("Root #thread", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := startNode(t, hub, Options{})
+	reply, err := a.Publish("@"+root+" Reply", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "b has the reply", cached(b, reply))
+
+	if _, missing := b.Thread(reply); missing != root {
+		t.Fatalf("missing %q, want the root %s", missing, root)
+	}
+	thread, err := b.FetchThread(reply, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thread.Hash != root || thread.Entry == nil || len(thread.Replies) != 1 || thread.Replies[0].Hash != reply {
+		t.Errorf("thread %+v, want the root with the reply", thread)
+	}
+}
+
+// TestFetchThreadHidden checks that an ancestor that is cached but can't
+// be decrypted is not asked for again and again.
+func TestFetchThreadHidden(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	a := startNode(t, hub, Options{})
+	b := startNode(t, hub, Options{})
+
+	root, err := a.PublishChannel(seal.NewChannel("secret", "passphrase"), "Root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := a.Publish("@"+root+" Reply", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "b has both", func() bool { return cached(b, root)() && cached(b, reply)() })
+
+	timeout := 100 * time.Millisecond
+	start := time.Now()
+	thread, err := b.FetchThread(reply, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= timeout {
+		t.Errorf("FetchThread took %v, asking for the hidden ancestor", elapsed)
+	}
+	if thread.Hash != root || thread.Entry != nil {
+		t.Errorf("thread %+v, want the hidden root without entry", thread)
+	}
+}
+
+func TestFetchCountsAdded(t *testing.T) {
+	hub := transport.NewMemoryHub()
+	a := startNode(t, hub, Options{})
+	hash, err := a.Publish("Before b #fetch", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := startNode(t, hub, Options{})
+
+	q := olnjson.Query{Hashes: []string{hash}}
+	fresh, replies, err := b.Fetch(q, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh != 1 || replies != 1 {
+		t.Errorf("Fetch = %d fresh from %d replies, want 1 from 1", fresh, replies)
+	}
+
+	fresh, _, err = b.Fetch(q, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh != 0 {
+		t.Errorf("Fetch again = %d fresh, want 0", fresh)
+	}
+}
+
+func TestShortMentionsNotReplies(t *testing.T) {
+	n := startNode(t, transport.NewMemoryHub(), Options{})
+	hash, err := n.Publish("cc @TV hi", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, missing := n.Thread(hash)
+	if missing != "" || root.Hash != hash {
+		t.Errorf("Thread = %s missing %q, want the message itself", root.Hash, missing)
+	}
+}
@@ -0,0 +1,153 @@
+package olnjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// CanonicalTimeFormat is the timestamp layout used in the canonical form:
+// UTC with exactly three fractional digits.
+const CanonicalTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// Now returns the current time truncated to the precision kept by the
+// canonical form, so a message survives a canonical round trip unchanged.
+func Now() time.Time {
+	return time.Now().Truncate(time.Millisecond)
+}
+
+// Canonical returns the canonical encoding of a message. It is JSON in the
+// style of RFC 8785: no whitespace, object keys in sorted order, minimal
+// string escaping and every field of Message always present. Tags are
+// sorted and deduplicated and the timestamp is written in UTC with
+// millisecond precision (CanonicalTimeFormat).
+//
+// The canonical form is what hashes and signatures are computed over, so
+// other implementations must reproduce it byte for byte.
+func Canonical(msg Message) ([]byte, error) {
+	ts := msg.Timestamp.UTC()
+	if ts.Year() < 0 || ts.Year() > 9999 {
+		return nil, fmt.Errorf("timestamp out of range: %v", msg.Timestamp)
+	}
+
+	var buf bytes.Buffer
+	w := canonicalWriter{buf: &buf}
+
+	buf.WriteString(`{"hops":`)
+	buf.WriteString(strconv.Itoa(msg.Hops))
+	buf.WriteString(`,"origin":{"display":`)
+	w.writeString(msg.Origin.Display)
+	buf.WriteString(`,"pubkey":`)
+	w.writeString(msg.Origin.PubKey)
+	buf.WriteString(`,"servername":`)
+	w.writeString(msg.Origin.ServerName)
+	buf.WriteString(`},"raw":`)
+	w.writeString(msg.Raw)
+	buf.WriteString(`,"sig":`)
+	w.writeString(msg.Sig)
+	buf.WriteString(`,"tags":[`)
+	for i, tag := range canonicalTags(msg.Tags) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		w.writeString(tag)
+	}
+	buf.WriteString(`],"timestamp":`)
+	w.writeString(ts.Format(CanonicalTimeFormat))
+	buf.WriteString(`,"ttl":`)
+	buf.WriteString(strconv.Itoa(msg.TTL))
+	buf.WriteByte('}')
+
+	if w.err != nil {
+		return nil, w.err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseCanonical decodes a message from its canonical encoding. Input that
+// is valid JSON but not in canonical form is rejected.
+func ParseCanonical(data []byte) (Message, error) {
+	var msg Message
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&msg); err != nil {
+		return Message{}, fmt.Errorf("invalid canonical message: %v", err)
+	}
+	if dec.More() {
+		return Message{}, fmt.Errorf("invalid canonical message: trailing data")
+	}
+
+	encoded, err := Canonical(msg)
+	if err != nil {
+		return Message{}, err
+	}
+	if !bytes.Equal(encoded, data) {
+		return Message{}, fmt.Errorf("message is not in canonical form")
+	}
+
+	msg.Tags = canonicalTags(msg.Tags)
+	msg.Timestamp = msg.Timestamp.UTC()
+	return msg, nil
+}
+
+// canonicalTags returns the tags sorted and without duplicates.
+func canonicalTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+type canonicalWriter struct {
+	buf *bytes.Buffer
+	err error
+}
+
+// writeString writes s as a JSON string, escaping only what JSON requires.
+func (w *canonicalWriter) writeString(s string) {
+	if !utf8.ValidString(s) {
+		w.err = fmt.Errorf("string is not valid UTF-8: %q", s)
+		return
+	}
+
+	const hex = "0123456789abcdef"
+	w.buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			w.buf.WriteString(`\"`)
+		case '\\':
+			w.buf.WriteString(`\\`)
+		case '\b':
+			w.buf.WriteString(`\b`)
+		case '\f':
+			w.buf.WriteString(`\f`)
+		case '\n':
+			w.buf.WriteString(`\n`)
+		case '\r':
+			w.buf.WriteString(`\r`)
+		case '\t':
+			w.buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				w.buf.WriteString(`\u00`)
+				w.buf.WriteByte(hex[c>>4])
+				w.buf.WriteByte(hex[c&0xf])
+			} else {
+				w.buf.WriteByte(c)
+			}
+		}
+	}
+	w.buf.WriteByte('"')
+}
@@ -0,0 +1,122 @@
+package olnjson_test
+
+import (
+	"crypto/ed25519"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/multihash"
+	"github.com/lapingvino/eolnpoc/olnjson"
+	"github.com/lapingvino/eolnpoc/signing"
+)
+
+// The test vector of the README, signed with the key whose seed is 32 zero
+// bytes.
+const (
+	vectorCanonical = `{"hops":0,"origin":{"display":"anonymous","pubkey":"O2onvM62pC1io6jQKm8Nc2UyFXcd4kOmOsBIoYtZ2ik=","servername":""},"raw":"Hello #OLN from 6FG22222+22 \"quoted\"\n","sig":"neuAqRaKOvY2u7aiMjUWCPWhvDdMmRabicIEpVej8m5dQJ9KvRwDf-ataNNARqyKu9C_ymByjDLApq1erdaDDA==","tags":["#OLN","6FG22222+22"],"timestamp":"2024-05-01T12:00:00.250Z","ttl":7}`
+	vectorSigning   = `{"hops":0,"origin":{"display":"anonymous","pubkey":"O2onvM62pC1io6jQKm8Nc2UyFXcd4kOmOsBIoYtZ2ik=","servername":""},"raw":"Hello #OLN from 6FG22222+22 \"quoted\"\n","sig":"","tags":["#OLN","6FG22222+22"],"timestamp":"2024-05-01T12:00:00.250Z","ttl":7}`
+	vectorID        = "QmQpkTkDG6SGbCR4DBLgqw2dobJGSSS9aGJXKspAbrqqeZ"
+	vectorUnsigned  = "QmZsCS9wB7XD6UGZ3QJPwVvW2pFxD9T9U3JKprNQ2jmTgF"
+)
+
+func vectorMessage() olnjson.Message {
+	return olnjson.Message{
+		Raw:       "Hello #OLN from 6FG22222+22 \"quoted\"\n",
+		Tags:      []string{"6FG22222+22", "#OLN", "#OLN"},
+		Origin:    olnjson.Origin{Display: "anonymous"},
+		Timestamp: time.Date(2024, 5, 1, 14, 0, 0, 250e6, time.FixedZone("CEST", 2*60*60)),
+		TTL:       7,
+	}
+}
+
+func TestCanonicalVector(t *testing.T) {
+	msg := vectorMessage()
+
+	id, err := multihash.Sum(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != vectorUnsigned {
+		t.Errorf("unsigned ID = %s, want %s", id, vectorUnsigned)
+	}
+
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	if err := signing.Sign(key, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	canonical, err := olnjson.Canonical(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(canonical) != vectorCanonical {
+		t.Errorf("canonical:\n got %s\nwant %s", canonical, vectorCanonical)
+	}
+
+	signingBytes, err := msg.SigningBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(signingBytes) != vectorSigning {
+		t.Errorf("signing bytes:\n got %s\nwant %s", signingBytes, vectorSigning)
+	}
+
+	// Hops are not part of the ID
+	msg.Hops = 3
+	id, err = multihash.Sum(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != vectorID {
+		t.Errorf("ID = %s, want %s", id, vectorID)
+	}
+}
+
+func TestParseCanonical(t *testing.T) {
+	msg, err := olnjson.ParseCanonical([]byte(vectorCanonical))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signing.Verify(msg); err != nil {
+		t.Errorf("vector does not verify: %v", err)
+	}
+
+	want := vectorMessage()
+	want.Tags = []string{"#OLN", "6FG22222+22"}
+	want.Timestamp = want.Timestamp.UTC()
+	want.Origin.PubKey = msg.Origin.PubKey
+	want.Sig = msg.Sig
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("ParseCanonical = %+v, want %+v", msg, want)
+	}
+
+	encoded, err := olnjson.Canonical(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != vectorCanonical {
+		t.Errorf("round trip:\n got %s\nwant %s", encoded, vectorCanonical)
+	}
+}
+
+func TestParseCanonicalRejects(t *testing.T) {
+	tests := map[string]string{
+		"whitespace":     `{"hops": 0,"origin":{"display":"","pubkey":"","servername":""},"raw":"","sig":"","tags":[],"timestamp":"2024-05-01T12:00:00.000Z","ttl":7}`,
+		"unsorted tags":  `{"hops":0,"origin":{"display":"","pubkey":"","servername":""},"raw":"","sig":"","tags":["b","a"],"timestamp":"2024-05-01T12:00:00.000Z","ttl":7}`,
+		"missing field":  `{"hops":0,"origin":{"display":"","pubkey":"","servername":""},"raw":"","tags":[],"timestamp":"2024-05-01T12:00:00.000Z","ttl":7}`,
+		"unknown field":  `{"extra":1,"hops":0,"origin":{"display":"","pubkey":"","servername":""},"raw":"","sig":"","tags":[],"timestamp":"2024-05-01T12:00:00.000Z","ttl":7}`,
+		"local time":     `{"hops":0,"origin":{"display":"","pubkey":"","servername":""},"raw":"","sig":"","tags":[],"timestamp":"2024-05-01T14:00:00.000+02:00","ttl":7}`,
+		"escaped ascii":  `{"hops":0,"origin":{"display":"","pubkey":"","servername":""},"raw":"\u0041","sig":"","tags":[],"timestamp":"2024-05-01T12:00:00.000Z","ttl":7}`,
+		"trailing data":  `{"hops":0,"origin":{"display":"","pubkey":"","servername":""},"raw":"","sig":"","tags":[],"timestamp":"2024-05-01T12:00:00.000Z","ttl":7}{}`,
+		"not json":       `hello`,
+		"uppercase hex":  `{"hops":0,"origin":{"display":"","pubkey":"","servername":""},"raw":"\u001F","sig":"","tags":[],"timestamp":"2024-05-01T12:00:00.000Z","ttl":7}`,
+		"no fraction":    `{"hops":0,"origin":{"display":"","pubkey":"","servername":""},"raw":"","sig":"","tags":[],"timestamp":"2024-05-01T12:00:00Z","ttl":7}`,
+		"duplicate tags": `{"hops":0,"origin":{"display":"","pubkey":"","servername":""},"raw":"","sig":"","tags":["a","a"],"timestamp":"2024-05-01T12:00:00.000Z","ttl":7}`,
+	}
+	for name, input := range tests {
+		if _, err := olnjson.ParseCanonical([]byte(input)); err == nil {
+			t.Errorf("%s: ParseCanonical accepted %s", name, input)
+		}
+	}
+}
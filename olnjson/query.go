@@ -0,0 +1,16 @@
+package olnjson
+
+import "time"
+
+// Query asks peers for messages they have cached. It travels as the Query
+// field of a Format on the query subject; peers answer with a Format
+// holding the matching messages, published on ReplyTo.
+type Query struct {
+	Tags    []string  `json:"tags"`    // Any of these hashtags, empty for all
+	Plustag string    `json:"plustag"` // Messages located inside this plus code area
+	Origin  string    `json:"origin"`  // Public key or display name of the sender
+	Since   time.Time `json:"since"`   // Messages published at or after this time
+	Hashes  []string  `json:"hashes"`  // Only these messages, empty for any
+	Limit   int       `json:"limit"`   // Maximum number of messages per reply, 0 for the peer's default
+	ReplyTo string    `json:"replyto"` // Subject to publish replies on
+}
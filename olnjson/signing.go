@@ -0,0 +1,11 @@
+package olnjson
+
+// SigningBytes returns the representation of the message that signatures and
+// content hashes are computed over: its canonical form with Sig and Hops
+// zeroed. Sig is left out because it is derived from these bytes, and Hops
+// because it changes every time the message is rebroadcast.
+func (m Message) SigningBytes() ([]byte, error) {
+	m.Sig = ""
+	m.Hops = 0
+	return Canonical(m)
+}
@@ -0,0 +1,90 @@
+package olnjson
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Sync lets nodes reconcile their caches instead of resending everything.
+// It travels as the Sync field of a Format:
+//
+//   - A node periodically publishes a summary on the sync subject: Filter
+//     holds every message it has seen, Tags and Plustags say what it wants.
+//   - Peers answer on ReplyTo with an offer: the hashes they hold that are
+//     missing from the filter (or from Have, in summaries of nodes without
+//     filters) and match the tags.
+//   - The node asks one offerer for each missing hash by sending Want to
+//     the offer's ReplyTo, which answers with a Format holding the messages.
+type Sync struct {
+	Have     []string `json:"have"`             // Message hashes, in an offer
+	Filter   *Filter  `json:"filter,omitempty"` // Message hashes, in a summary
+	Want     []string `json:"want"`             // Message hashes asked for
+	Tags     []string `json:"tags"`             // Messages with any of these hashtags are wanted, all if Tags and Plustags are empty
+	Plustags []string `json:"plustags"`         // And messages located inside any of these plus code areas
+	ReplyTo  string   `json:"replyto"`          // Subject to send offers, wants or messages to
+}
+
+const (
+	filterBitsPerHash = 10 // About 1% false positives
+	filterHashes      = 7  // Bits set per message hash
+)
+
+// Filter is a Bloom filter of message hashes. A message hash sets the
+// bits h1 + i*h2 mod len(Bits)*8 for i from 0 to 6, where h1 and h2 are
+// the first two big-endian uint64s of the SHA-256 of the four big-endian
+// bytes of Seed followed by the hash. Bit n is bit n%8 of byte n/8.
+//
+// Has may report hashes that were never added, so offers can miss a
+// message now and then. Summaries pick a new seed every time, so the next
+// summary misses other ones.
+type Filter struct {
+	Seed uint32 `json:"seed"`
+	Bits []byte `json:"bits"` // Standard base64 in JSON
+}
+
+// NewFilter returns a filter holding hashes.
+func NewFilter(seed uint32, hashes []string) *Filter {
+	size := (len(hashes)*filterBitsPerHash + 7) / 8
+	f := &Filter{Seed: seed, Bits: make([]byte, max(size, 8))}
+	for _, hash := range hashes {
+		f.Add(hash)
+	}
+	return f
+}
+
+// Add adds hash to the filter.
+func (f *Filter) Add(hash string) {
+	if len(f.Bits) == 0 {
+		return
+	}
+	h1, h2 := f.sum(hash)
+	m := uint64(len(f.Bits)) * 8
+	for i := uint64(0); i < filterHashes; i++ {
+		bit := (h1 + i*h2) % m
+		f.Bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Has reports whether hash may have been added to the filter.
+func (f *Filter) Has(hash string) bool {
+	if len(f.Bits) == 0 {
+		return false
+	}
+	h1, h2 := f.sum(hash)
+	m := uint64(len(f.Bits)) * 8
+	for i := uint64(0); i < filterHashes; i++ {
+		bit := (h1 + i*h2) % m
+		if f.Bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Filter) sum(hash string) (uint64, uint64) {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, f.Seed)
+	h.Write([]byte(hash))
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:16])
+}
@@ -0,0 +1,64 @@
+package olnjson_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+func TestFilter(t *testing.T) {
+	var hashes []string
+	for i := 0; i < 1000; i++ {
+		hashes = append(hashes, fmt.Sprintf("Qm%d", i))
+	}
+	f := olnjson.NewFilter(42, hashes)
+
+	// The filter survives JSON, where it travels
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded olnjson.Filter
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hash := range hashes {
+		if !decoded.Has(hash) {
+			t.Fatalf("filter lacks %s", hash)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if decoded.Has(fmt.Sprintf("Qx%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("%d false positives in 10000, want about 100", falsePositives)
+	}
+
+	// Another seed gives other false positives
+	other := olnjson.NewFilter(43, hashes)
+	same := 0
+	for i := 0; i < 10000; i++ {
+		hash := fmt.Sprintf("Qx%d", i)
+		if decoded.Has(hash) && other.Has(hash) {
+			same++
+		}
+	}
+	if same > 10 {
+		t.Errorf("%d false positives shared between seeds", same)
+	}
+
+	if olnjson.NewFilter(1, nil).Has("Qm0") {
+		t.Error("empty filter has a hash")
+	}
+	var zero olnjson.Filter
+	if zero.Has("Qm0") {
+		t.Error("zero filter has a hash")
+	}
+}
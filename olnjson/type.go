@@ -11,6 +11,8 @@ type Format struct {
 	Index    map[string][]string `json:"index"`
 	Feeds    []string            `json:"feeds"`
 	Push     []string            `json:"push"`
+	Query    *Query              `json:"query,omitempty"` // Only set on query requests
+	Sync     *Sync               `json:"sync,omitempty"`  // Only set on cache reconciliation
 }
 
 // ServerInfo contains information about an OLN server.
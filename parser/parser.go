@@ -0,0 +1,221 @@
+// Package parser splits the raw text of OLN messages into the entities the
+// message format knows about: #hashtags, plustags, @mentions of origins or
+// message hashes, http(s) and /ipfs/ /ipns/ links, key:value entries and
+// [Alttext](target) for any of those.
+//
+// A key is a lowercase letter followed by up to 31 lowercase letters,
+// digits and dashes. The value follows the colon without spaces and does
+// not start with a slash or colon, so URLs are not keys; nor are URI
+// schemes like mailto: or host:port addresses on localhost.
+package parser
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/location"
+	"github.com/lapingvino/eolnpoc/multihash"
+)
+
+// Kind is the type of an entity.
+type Kind int
+
+const (
+	Hashtag Kind = iota + 1
+	Plustag
+	Mention
+	Link
+	Key
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Hashtag:
+		return "hashtag"
+	case Plustag:
+		return "plustag"
+	case Mention:
+		return "mention"
+	case Link:
+		return "link"
+	case Key:
+		return "key"
+	}
+	return "unknown"
+}
+
+// Entity is a piece of a message text with a meaning of its own.
+type Entity struct {
+	Kind  Kind
+	Start int    // Byte offset of the entity in the text
+	End   int    // Byte offset just past it, including any alttext
+	Value string // #hashtag, full plus code, mention without @, link or key:value
+	Alt   string // Text of [Alt](target), empty if not given
+}
+
+// Tag returns the form of the entity used in Message.Tags and the index.
+func (e Entity) Tag() string {
+	if e.Kind == Mention {
+		return "@" + e.Value
+	}
+	return e.Value
+}
+
+// IsHash reports whether a mention refers to a message instead of an
+// origin.
+func (e Entity) IsHash() bool {
+	return e.Kind == Mention && multihash.IsID(e.Value)
+}
+
+var (
+	alttextPattern = regexp.MustCompile(`\[([^\[\]\n]+)\]\(([^()\s]+)\)`)
+	hashtagPattern = regexp.MustCompile(`#\w+`)
+	geoPattern     = regexp.MustCompile(`^#geo(\w+)$`)
+	mentionPattern = regexp.MustCompile(`^@[A-Za-z0-9_=-]+$`)
+	keyPattern     = regexp.MustCompile(`^([a-z][a-z0-9-]{0,31}):([^\s/:]\S*)$`)
+)
+
+// Words before a colon that make a link or an address rather than a key
+var notKeys = map[string]bool{
+	"mailto": true, "tel": true, "sms": true, "geo": true, "magnet": true,
+	"urn": true, "data": true, "file": true, "ftp": true, "irc": true,
+	"xmpp": true, "ssh": true, "news": true, "localhost": true,
+}
+
+// Characters around a word that are punctuation rather than part of it
+const (
+	leadingPunct  = `(["'`
+	trailingPunct = `.,;:!?)]"'`
+)
+
+var linkPrefixes = []string{"http://", "https://", "/ipfs/", "/ipns/"}
+
+// Parse returns the entities in text ordered by offset. A #geo hashtag
+// yields both a hashtag and a plustag with the same offsets.
+func Parse(text string) []Entity {
+	var entities []Entity
+	covered := make([]bool, len(text))
+
+	for _, m := range alttextPattern.FindAllStringSubmatchIndex(text, -1) {
+		alt := strings.TrimSpace(text[m[2]:m[3]])
+		found := wordEntities(text[m[4]:m[5]], m[4])
+		if alt == "" || len(found) == 0 {
+			continue
+		}
+		for _, e := range found {
+			e.Start, e.End, e.Alt = m[0], m[1], alt
+			entities = append(entities, e)
+		}
+		for i := m[0]; i < m[1]; i++ {
+			covered[i] = true
+		}
+	}
+
+	start := -1
+	for i := 0; i <= len(text); i++ {
+		if i < len(text) && !covered[i] && !isSpace(text[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			entities = append(entities, wordEntities(text[start:i], start)...)
+			start = -1
+		}
+	}
+
+	sort.SliceStable(entities, func(i, j int) bool {
+		return entities[i].Start < entities[j].Start
+	})
+	return entities
+}
+
+// wordEntities returns the entities in word, a run of text without spaces
+// found at offset.
+func wordEntities(word string, offset int) []Entity {
+	trimmed := strings.TrimLeft(word, leadingPunct)
+	offset += len(word) - len(trimmed)
+	word = trimmed
+	trimmed = strings.TrimRight(word, trailingPunct)
+	if trimmed == "" {
+		return nil
+	}
+	end := offset + len(trimmed)
+
+	for _, prefix := range linkPrefixes {
+		if strings.HasPrefix(trimmed, prefix) && len(trimmed) > len(prefix) {
+			return []Entity{{Kind: Link, Start: offset, End: end, Value: trimmed}}
+		}
+	}
+	if mentionPattern.MatchString(trimmed) {
+		return []Entity{{Kind: Mention, Start: offset, End: end, Value: trimmed[1:]}}
+	}
+	if m := keyPattern.FindStringSubmatch(trimmed); m != nil && !notKeys[m[1]] {
+		return []Entity{{Kind: Key, Start: offset, End: end, Value: trimmed}}
+	}
+
+	var entities []Entity
+	for _, loc := range hashtagPattern.FindAllStringIndex(word, -1) {
+		tag := word[loc[0]:loc[1]]
+		entities = append(entities, Entity{Kind: Hashtag, Start: offset + loc[0], End: offset + loc[1], Value: tag})
+		if m := geoPattern.FindStringSubmatch(tag); m != nil {
+			if code := strings.ToUpper(m[1]) + "+"; location.ValidatePluscode(code) {
+				entities = append(entities, Entity{Kind: Plustag, Start: offset + loc[0], End: offset + loc[1], Value: code})
+			}
+		}
+	}
+	for _, code := range location.ExtractPluscodes(trimmed) {
+		i := strings.Index(trimmed, code)
+		entities = append(entities, Entity{Kind: Plustag, Start: offset + i, End: offset + i + len(code), Value: code})
+	}
+	return entities
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// Tags returns the distinct tags of the entities in text, in order: what
+// goes into Message.Tags.
+func Tags(text string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, e := range Parse(text) {
+		if tag := e.Tag(); !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Alttexts maps the tags of the entities in text that have an alttext to
+// the first alttext given for them.
+func Alttexts(text string) map[string]string {
+	alts := make(map[string]string)
+	for _, e := range Parse(text) {
+		if _, ok := alts[e.Tag()]; e.Alt != "" && !ok {
+			alts[e.Tag()] = e.Alt
+		}
+	}
+	return alts
+}
+
+// Unpack returns text with every [Alttext](target) replaced by its
+// alttext, for display.
+func Unpack(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, e := range Parse(text) {
+		if e.Alt == "" || e.Start < last {
+			continue
+		}
+		b.WriteString(text[last:e.Start])
+		b.WriteString(e.Alt)
+		last = e.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
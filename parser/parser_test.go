@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const hash = "QmQpkTkDG6SGbCR4DBLgqw2dobJGSSS9aGJXKspAbrqqeZ"
+
+	tests := []struct {
+		text string
+		want []Entity
+	}{
+		{"Hello #OLN!", []Entity{
+			{Kind: Hashtag, Start: 6, End: 10, Value: "#OLN"},
+		}},
+		{"Meet at 6FG22222+22.", []Entity{
+			{Kind: Plustag, Start: 8, End: 19, Value: "6FG22222+22"},
+		}},
+		{"#geo9F469VXG and #geo9f469vxg", []Entity{
+			{Kind: Hashtag, Start: 0, End: 12, Value: "#geo9F469VXG"},
+			{Kind: Plustag, Start: 0, End: 12, Value: "9F469VXG+"},
+			{Kind: Hashtag, Start: 17, End: 29, Value: "#geo9f469vxg"},
+			{Kind: Plustag, Start: 17, End: 29, Value: "9F469VXG+"},
+		}},
+		{"(@alice) @" + hash, []Entity{
+			{Kind: Mention, Start: 1, End: 7, Value: "alice"},
+			{Kind: Mention, Start: 9, End: 56, Value: hash},
+		}},
+		{"See https://example.com/a?b=c, /ipfs/Qm1", []Entity{
+			{Kind: Link, Start: 4, End: 29, Value: "https://example.com/a?b=c"},
+			{Kind: Link, Start: 31, End: 40, Value: "/ipfs/Qm1"},
+		}},
+		{"mood:happy trust:3:O2on/vM= x-y:1", []Entity{
+			{Kind: Key, Start: 0, End: 10, Value: "mood:happy"},
+			{Kind: Key, Start: 11, End: 27, Value: "trust:3:O2on/vM="},
+			{Kind: Key, Start: 28, End: 33, Value: "x-y:1"},
+		}},
+		{"Re:thing localhost:8080 mailto:x tel:+31 ftp://x a:/b :x x: éé:x", nil},
+		{"[Amsterdam Centraal](9F469VXG+) is [here](#geo9F469VXG)", []Entity{
+			{Kind: Plustag, Start: 0, End: 31, Value: "9F469VXG+", Alt: "Amsterdam Centraal"},
+			{Kind: Hashtag, Start: 35, End: 55, Value: "#geo9F469VXG", Alt: "here"},
+			{Kind: Plustag, Start: 35, End: 55, Value: "9F469VXG+", Alt: "here"},
+		}},
+		{"[ ](#empty) [no target]()", []Entity{
+			{Kind: Hashtag, Start: 4, End: 10, Value: "#empty"},
+		}},
+		{"Grüße #OLN", []Entity{
+			{Kind: Hashtag, Start: 8, End: 12, Value: "#OLN"},
+		}},
+	}
+	for _, tt := range tests {
+		got := Parse(tt.text)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q):\n got %+v\nwant %+v", tt.text, got, tt.want)
+			continue
+		}
+		for _, e := range got {
+			// Offsets are in bytes and cover the entity as written
+			literal := e.Kind == Hashtag || e.Kind == Link || e.Kind == Key
+			if e.Alt == "" && literal && tt.text[e.Start:e.End] != e.Value {
+				t.Errorf("Parse(%q): %s at %d:%d is %q, not %q", tt.text, e.Kind, e.Start, e.End, tt.text[e.Start:e.End], e.Value)
+			}
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	got := Tags("#OLN @alice #OLN mood:happy [Home](6FG22222+22)")
+	want := []string{"#OLN", "@alice", "mood:happy", "6FG22222+22"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tags = %v, want %v", got, want)
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	text := "At [Amsterdam Centraal](9F469VXG+), see [the site](https://example.com) #OLN"
+	want := "At Amsterdam Centraal, see the site #OLN"
+	if got := Unpack(text); got != want {
+		t.Errorf("Unpack = %q, want %q", got, want)
+	}
+	alts := Alttexts(text)
+	if alts["9F469VXG+"] != "Amsterdam Centraal" || alts["https://example.com"] != "the site" || len(alts) != 2 {
+		t.Errorf("Alttexts = %v", alts)
+	}
+}
+
+func TestIsHash(t *testing.T) {
+	for value, want := range map[string]bool{
+		"QmQpkTkDG6SGbCR4DBLgqw2dobJGSSS9aGJXKspAbrqqeZ": true,
+		"TV":    false,
+		"EF":    false,
+		"11":    false,
+		"alice": false,
+		"QmQpkTkDG6SGbCR4DBLgqw2dobJGSSS9aGJXKspAbrqqe": false,
+	} {
+		if got := (Entity{Kind: Mention, Value: value}).IsHash(); got != want {
+			t.Errorf("IsHash(@%s) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package seal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ChannelPrefix marks the raw text of a message encrypted to a channel.
+// The full form is "ch:<channel id>:<base64 nonce+ciphertext>".
+const ChannelPrefix = "ch:"
+
+// channelIDSize is the number of bytes of a channel ID, written in hex.
+const channelIDSize = 8
+
+// Channel is a group chat room secured by a shared passphrase.
+type Channel struct {
+	Name string
+	ID   string // Public identifier derived from the key
+	key  []byte
+}
+
+// NewChannel derives the key of a channel from its name and passphrase
+// with Argon2id. Everyone using the same name and passphrase ends up in
+// the same channel; the name acts as the salt.
+func NewChannel(name, passphrase string) *Channel {
+	key := argon2.IDKey([]byte(passphrase), []byte("oln-channel:"+name), 1, 64*1024, 4, chacha20poly1305.KeySize)
+	id := sha256.Sum256(append([]byte("oln-channel-id:"), key...))
+	return &Channel{
+		Name: name,
+		ID:   hex.EncodeToString(id[:channelIDSize]),
+		key:  key,
+	}
+}
+
+// IsChannel reports whether raw holds a channel-encrypted message in the
+// full form "ch:<16 hex digit id>:<base64 nonce+ciphertext>".
+func IsChannel(raw string) bool {
+	rest, ok := strings.CutPrefix(raw, ChannelPrefix)
+	if !ok {
+		return false
+	}
+	id, payload, ok := strings.Cut(rest, ":")
+	if !ok || len(id) != channelIDSize*2 || strings.ToLower(id) != id {
+		return false
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return false
+	}
+	sealed, err := base64.URLEncoding.DecodeString(payload)
+	return err == nil && len(sealed) >= chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead
+}
+
+// IsEncrypted reports whether raw holds any kind of encrypted message.
+func IsEncrypted(raw string) bool {
+	return IsDirect(raw) || IsChannel(raw)
+}
+
+// Seal encrypts text for the channel with XChaCha20-Poly1305 and returns
+// it in the form used for Message.Raw.
+func (c *Channel) Seal(text string) (string, error) {
+	aead, err := chacha20poly1305.NewX(c.key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(text)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(text), []byte(c.ID))
+
+	return ChannelPrefix + c.ID + ":" + base64.URLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a channel message. It returns ErrNotForUs if the message
+// belongs to a different channel or does not authenticate.
+func (c *Channel) Open(raw string) (string, error) {
+	if !IsChannel(raw) {
+		return "", ErrNotForUs
+	}
+	id, payload, ok := strings.Cut(strings.TrimPrefix(raw, ChannelPrefix), ":")
+	if !ok || id != c.ID {
+		return "", ErrNotForUs
+	}
+
+	sealed, err := base64.URLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := chacha20poly1305.NewX(c.key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("channel message too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	text, err := aead.Open(nil, nonce, ciphertext, []byte(c.ID))
+	if err != nil {
+		return "", ErrNotForUs
+	}
+	return string(text), nil
+}
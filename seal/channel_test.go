@@ -0,0 +1,46 @@
+package seal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChannel(t *testing.T) {
+	c := NewChannel("room", "secret")
+	raw, err := c.Seal("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsChannel(raw) || !IsEncrypted(raw) {
+		t.Errorf("IsChannel(%q) = false", raw)
+	}
+	if text, err := c.Open(raw); err != nil || text != "hello" {
+		t.Errorf("Open = %q, %v", text, err)
+	}
+	if _, err := NewChannel("room", "other").Open(raw); err != ErrNotForUs {
+		t.Errorf("Open with other passphrase: %v, want ErrNotForUs", err)
+	}
+}
+
+func TestIsChannel(t *testing.T) {
+	payload := strings.Repeat("A", 56) // 42 bytes, nonce and tag
+	tests := []struct {
+		raw  string
+		want bool
+	}{
+		{"ch: anyone around?", false},
+		{"ch:general:hello", false},
+		{"ch:0123456789abcdef:" + payload, true},
+		{"ch:0123456789ABCDEF:" + payload, false},
+		{"ch:0123456789abcde:" + payload, false},
+		{"ch:0123456789abcdeg:" + payload, false},
+		{"ch:0123456789abcdef:AAAA", false},
+		{"ch:0123456789abcdef:not base64!", false},
+		{"ch:0123456789abcdef", false},
+	}
+	for _, tt := range tests {
+		if got := IsChannel(tt.raw); got != tt.want {
+			t.Errorf("IsChannel(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
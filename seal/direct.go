@@ -0,0 +1,65 @@
+package seal
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// DirectPrefix marks the raw text of a message encrypted to a single recipient.
+const DirectPrefix = "dm:"
+
+// ErrNotForUs is returned when a message cannot be decrypted with our keys.
+var ErrNotForUs = errors.New("message is not addressed to us")
+
+// IsDirect reports whether raw holds a direct (recipient-encrypted) message:
+// "dm:" followed by a base64 sealed box, not just any text starting with it.
+func IsDirect(raw string) bool {
+	payload, ok := strings.CutPrefix(raw, DirectPrefix)
+	if !ok {
+		return false
+	}
+	sealed, err := base64.URLEncoding.DecodeString(payload)
+	return err == nil && len(sealed) >= box.AnonymousOverhead
+}
+
+// Direct encrypts text to the holder of the recipient's ed25519 key and
+// returns it in the form used for Message.Raw. It is a NaCl sealed box to
+// the recipient's X25519 key: the ciphertext does not reveal the sender or
+// the recipient, so every node simply tries to open it.
+func Direct(recipient ed25519.PublicKey, text string) (string, error) {
+	pub, err := X25519PublicKey(recipient)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := box.SealAnonymous(nil, []byte(text), pub, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return DirectPrefix + base64.URLEncoding.EncodeToString(sealed), nil
+}
+
+// OpenDirect decrypts a direct message with our ed25519 identity.
+func OpenDirect(key ed25519.PrivateKey, raw string) (string, error) {
+	if !IsDirect(raw) {
+		return "", ErrNotForUs
+	}
+	sealed, err := base64.URLEncoding.DecodeString(strings.TrimPrefix(raw, DirectPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	pub, err := X25519PublicKey(key.Public().(ed25519.PublicKey))
+	if err != nil {
+		return "", err
+	}
+	text, ok := box.OpenAnonymous(nil, sealed, pub, X25519PrivateKey(key))
+	if !ok {
+		return "", ErrNotForUs
+	}
+	return string(text), nil
+}
@@ -0,0 +1,51 @@
+package seal
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+)
+
+func TestDirect(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := Direct(pub, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsDirect(raw) || !IsEncrypted(raw) {
+		t.Errorf("IsDirect(%q) = false", raw)
+	}
+	if text, err := OpenDirect(key, raw); err != nil || text != "hello" {
+		t.Errorf("OpenDirect = %q, %v", text, err)
+	}
+	if _, err := OpenDirect(other, raw); err != ErrNotForUs {
+		t.Errorf("OpenDirect with other key: %v, want ErrNotForUs", err)
+	}
+}
+
+func TestIsDirect(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want bool
+	}{
+		{"dm: is what I sent you", false},
+		{"dm:hello", false},
+		{"dm:", false},
+		{"dm:" + "AAAA", false}, // Shorter than a sealed box
+		{"dm:" + "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", true},
+		{"hello dm:AAAA", false},
+	}
+	for _, tt := range tests {
+		if got := IsDirect(tt.raw); got != tt.want {
+			t.Errorf("IsDirect(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
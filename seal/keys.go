@@ -0,0 +1,62 @@
+package seal
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"fmt"
+	"math/big"
+)
+
+// Field prime of curve25519: 2^255 - 19
+var curveP = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// X25519PublicKey converts an ed25519 public key to the X25519 public key
+// of the same identity, using the birational map u = (1+y)/(1-y).
+func X25519PublicKey(pub ed25519.PublicKey) (*[32]byte, error) {
+	if len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key length: %d", len(pub))
+	}
+
+	// The key encodes y little-endian with the sign of x in the top bit
+	le := make([]byte, 32)
+	copy(le, pub)
+	le[31] &= 0x7f
+	y := new(big.Int).SetBytes(reverse(le))
+	if y.Cmp(curveP) >= 0 {
+		return nil, fmt.Errorf("invalid public key")
+	}
+
+	num := new(big.Int).Add(big.NewInt(1), y)
+	den := new(big.Int).Sub(big.NewInt(1), y)
+	den.Mod(den, curveP)
+	if den.Sign() == 0 {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	den.ModInverse(den, curveP)
+	u := num.Mul(num, den)
+	u.Mod(u, curveP)
+
+	var out [32]byte
+	copy(out[:], reverse(u.FillBytes(make([]byte, 32))))
+	return &out, nil
+}
+
+// X25519PrivateKey derives the X25519 private key matching X25519PublicKey
+// from an ed25519 private key.
+func X25519PrivateKey(priv ed25519.PrivateKey) *[32]byte {
+	h := sha512.Sum512(priv.Seed())
+	var out [32]byte
+	copy(out[:], h[:32])
+	out[0] &= 248
+	out[31] &= 127
+	out[31] |= 64
+	return &out
+}
+
+func reverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
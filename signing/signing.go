@@ -0,0 +1,206 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+var (
+	// ErrUnsigned is returned by Verify for messages without a signature or public key.
+	ErrUnsigned = errors.New("message is not signed")
+	// ErrBadSignature is returned by Verify when the signature does not match the message.
+	ErrBadSignature = errors.New("signature does not match message")
+)
+
+// Status describes the outcome of verifying a message signature.
+type Status int
+
+const (
+	Unsigned Status = iota // no signature or public key present
+	Valid                  // signature verifies against Origin.PubKey
+	Forged                 // signature present but invalid
+)
+
+// String returns a short human-readable name for the status.
+func (s Status) String() string {
+	switch s {
+	case Valid:
+		return "signed"
+	case Forged:
+		return "forged"
+	default:
+		return "unsigned"
+	}
+}
+
+// Policy decides which messages are dropped based on their signature status.
+type Policy int
+
+const (
+	// PolicyFlag keeps every message and only marks its status.
+	PolicyFlag Policy = iota
+	// PolicyDropForged drops messages whose signature does not verify.
+	PolicyDropForged
+	// PolicyDropUnsigned drops both forged and unsigned messages.
+	PolicyDropUnsigned
+)
+
+// ParsePolicy parses a policy name: flag, drop-forged or drop-unsigned.
+func ParsePolicy(name string) (Policy, error) {
+	switch name {
+	case "", "flag":
+		return PolicyFlag, nil
+	case "drop-forged":
+		return PolicyDropForged, nil
+	case "drop-unsigned":
+		return PolicyDropUnsigned, nil
+	}
+	return PolicyFlag, fmt.Errorf("unknown signature policy: %s", name)
+}
+
+// Accepts reports whether a message with the given status passes the policy.
+func (p Policy) Accepts(status Status) bool {
+	switch p {
+	case PolicyDropForged:
+		return status != Forged
+	case PolicyDropUnsigned:
+		return status == Valid
+	default:
+		return true
+	}
+}
+
+// GenerateKey creates a new random ed25519 identity.
+func GenerateKey() (ed25519.PrivateKey, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	return priv, err
+}
+
+// DefaultKeyPath returns the location of the identity used when none is given.
+func DefaultKeyPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "oln", "identity.key"), nil
+}
+
+// LoadKey reads an identity saved by SaveKey.
+func LoadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := base64.URLEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key: %v", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid key length: %d", len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// SaveKey writes the seed of an identity to path, readable only by the owner.
+func SaveKey(path string, key ed25519.PrivateKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	encoded := base64.URLEncoding.EncodeToString(key.Seed())
+	return os.WriteFile(path, []byte(encoded+"\n"), 0600)
+}
+
+// LoadOrCreateKey loads the identity at path, generating and saving a new
+// one if the file does not exist yet.
+func LoadOrCreateKey(path string) (ed25519.PrivateKey, error) {
+	key, err := LoadKey(path)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err = GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveKey(path, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncodePubKey returns the textual form of a public key used in Origin.PubKey.
+func EncodePubKey(pub ed25519.PublicKey) string {
+	return base64.URLEncoding.EncodeToString(pub)
+}
+
+// DecodePubKey parses a public key produced by EncodePubKey.
+func DecodePubKey(s string) (ed25519.PublicKey, error) {
+	data, err := base64.URLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %v", err)
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key length: %d", len(data))
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// Sign fills in Origin.PubKey and Sig of msg using key.
+func Sign(key ed25519.PrivateKey, msg *olnjson.Message) error {
+	msg.Origin.PubKey = EncodePubKey(key.Public().(ed25519.PublicKey))
+
+	data, err := msg.SigningBytes()
+	if err != nil {
+		return err
+	}
+	msg.Sig = base64.URLEncoding.EncodeToString(ed25519.Sign(key, data))
+	return nil
+}
+
+// Verify checks the signature of msg against Origin.PubKey.
+// It returns ErrUnsigned if either is missing.
+func Verify(msg olnjson.Message) error {
+	if msg.Sig == "" || msg.Origin.PubKey == "" {
+		return ErrUnsigned
+	}
+
+	pub, err := DecodePubKey(msg.Origin.PubKey)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.URLEncoding.DecodeString(msg.Sig)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %v", err)
+	}
+	data, err := msg.SigningBytes()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, data, sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Check verifies msg and reduces the result to a Status.
+func Check(msg olnjson.Message) Status {
+	switch err := Verify(msg); {
+	case err == nil:
+		return Valid
+	case errors.Is(err, ErrUnsigned):
+		return Unsigned
+	default:
+		return Forged
+	}
+}
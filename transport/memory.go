@@ -0,0 +1,149 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// Number of documents queued per subscription before new ones are dropped,
+// like a slow consumer on a real server
+const memoryQueueSize = 256
+
+// ErrClosed is returned when using a transport after Close.
+var ErrClosed = errors.New("transport closed")
+
+// MemoryHub is an in-process message bus. Every Memory transport connected
+// to the same hub sees the documents the others publish, which makes it
+// possible to run several nodes in one process without a server.
+type MemoryHub struct {
+	mu   sync.RWMutex
+	subs map[*memorySub]bool
+}
+
+// NewMemoryHub creates an empty hub.
+func NewMemoryHub() *MemoryHub {
+	return &MemoryHub{subs: make(map[*memorySub]bool)}
+}
+
+// Connect returns a new transport attached to the hub.
+func (h *MemoryHub) Connect() *Memory {
+	return &Memory{hub: h, subs: make(map[*memorySub]bool)}
+}
+
+// NewMemory returns a transport on a hub of its own, for a single node.
+func NewMemory() *Memory {
+	return NewMemoryHub().Connect()
+}
+
+// Memory is a Transport on a MemoryHub. Documents are copied through JSON
+// on delivery, so subscribers never share data with the publisher.
+type Memory struct {
+	hub    *MemoryHub
+	mu     sync.Mutex
+	subs   map[*memorySub]bool
+	closed bool
+}
+
+type memorySub struct {
+	owner   *Memory
+	pattern string
+	queue   chan []byte
+	once    sync.Once
+}
+
+// Publish delivers format to every matching subscription on the hub.
+func (t *Memory) Publish(subject string, format *olnjson.Format) error {
+	t.mu.Lock()
+	closed := t.closed
+	t.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+
+	data, err := json.Marshal(format)
+	if err != nil {
+		return err
+	}
+
+	t.hub.mu.RLock()
+	defer t.hub.mu.RUnlock()
+	for sub := range t.hub.subs {
+		if !MatchSubject(sub.pattern, subject) {
+			continue
+		}
+		select {
+		case sub.queue <- data:
+		default:
+			// Queue full, drop
+		}
+	}
+	return nil
+}
+
+// Subscribe calls handler for every document published on the hub that
+// matches subject. Handlers of one subscription run in order, on a
+// goroutine of their own.
+func (t *Memory) Subscribe(subject string, handler Handler) (Subscription, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	sub := &memorySub{
+		owner:   t,
+		pattern: subject,
+		queue:   make(chan []byte, memoryQueueSize),
+	}
+	t.subs[sub] = true
+
+	t.hub.mu.Lock()
+	t.hub.subs[sub] = true
+	t.hub.mu.Unlock()
+
+	go func() {
+		for data := range sub.queue {
+			var format olnjson.Format
+			if err := json.Unmarshal(data, &format); err == nil {
+				handler(&format)
+			}
+		}
+	}()
+
+	return sub, nil
+}
+
+// Unsubscribe stops delivery to the subscription.
+func (s *memorySub) Unsubscribe() error {
+	s.owner.mu.Lock()
+	delete(s.owner.subs, s)
+	s.owner.mu.Unlock()
+	s.close()
+	return nil
+}
+
+func (s *memorySub) close() {
+	s.once.Do(func() {
+		hub := s.owner.hub
+		hub.mu.Lock()
+		delete(hub.subs, s)
+		hub.mu.Unlock()
+		close(s.queue)
+	})
+}
+
+// Close removes all subscriptions of this transport from the hub.
+func (t *Memory) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	for sub := range t.subs {
+		sub.close()
+	}
+	t.subs = make(map[*memorySub]bool)
+	return nil
+}
@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// receive returns a handler that passes documents on to a channel.
+func receive() (Handler, chan *olnjson.Format) {
+	ch := make(chan *olnjson.Format, 16)
+	return func(format *olnjson.Format) { ch <- format }, ch
+}
+
+func expect(t *testing.T, ch chan *olnjson.Format, raw string) {
+	t.Helper()
+	select {
+	case format := <-ch:
+		if len(format.Messages) != 1 || format.Messages["hash"].Raw != raw {
+			t.Errorf("received %+v, want %q", format.Messages, raw)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("%q not received", raw)
+	}
+}
+
+func expectNothing(t *testing.T, ch chan *olnjson.Format) {
+	t.Helper()
+	select {
+	case format := <-ch:
+		t.Errorf("unexpected %+v", format.Messages)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func document(raw string) *olnjson.Format {
+	return &olnjson.Format{Messages: map[string]olnjson.Message{"hash": {Raw: raw}}}
+}
+
+func TestMemoryPubSub(t *testing.T) {
+	hub := NewMemoryHub()
+	a, b := hub.Connect(), hub.Connect()
+	defer a.Close()
+	defer b.Close()
+
+	all, allCh := receive()
+	tags, tagsCh := receive()
+	if _, err := b.Subscribe("oln.>", all); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Subscribe("oln.tag.*", tags); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Publish("oln.messages.v1", document("one")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, allCh, "one")
+	expectNothing(t, tagsCh)
+
+	if err := a.Publish("oln.tag.oln", document("two")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, allCh, "two")
+	expect(t, tagsCh, "two")
+
+	if err := a.Publish("other.subject", document("three")); err != nil {
+		t.Fatal(err)
+	}
+	expectNothing(t, allCh)
+}
+
+func TestMemoryCopies(t *testing.T) {
+	hub := NewMemoryHub()
+	a, b := hub.Connect(), hub.Connect()
+	defer a.Close()
+	defer b.Close()
+
+	handler, ch := receive()
+	if _, err := b.Subscribe("oln.messages.v1", handler); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := document("original")
+	if err := a.Publish("oln.messages.v1", doc); err != nil {
+		t.Fatal(err)
+	}
+	doc.Messages["hash"] = olnjson.Message{Raw: "changed"}
+	expect(t, ch, "original")
+}
+
+func TestMemoryUnsubscribe(t *testing.T) {
+	hub := NewMemoryHub()
+	a, b := hub.Connect(), hub.Connect()
+	defer a.Close()
+
+	handler, ch := receive()
+	sub, err := b.Subscribe("oln.messages.v1", handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	a.Publish("oln.messages.v1", document("gone"))
+	expectNothing(t, ch)
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Subscribe("oln.messages.v1", handler); err != ErrClosed {
+		t.Errorf("Subscribe after Close: %v, want ErrClosed", err)
+	}
+	if err := b.Publish("oln.messages.v1", document("closed")); err != ErrClosed {
+		t.Errorf("Publish after Close: %v, want ErrClosed", err)
+	}
+}
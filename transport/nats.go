@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"encoding/json"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// NATS is a Transport that sends documents as JSON over a NATS server.
+type NATS struct {
+	Conn *nats.Conn
+
+	// OnError, if set, is called for received payloads that are not valid
+	// OLN documents. They are skipped either way.
+	OnError func(err error)
+}
+
+// NewNATS connects to the NATS server at url.
+func NewNATS(url string) (*NATS, error) {
+	nc, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	return &NATS{Conn: nc}, nil
+}
+
+// Publish sends format on subject.
+func (t *NATS) Publish(subject string, format *olnjson.Format) error {
+	data, err := json.Marshal(format)
+	if err != nil {
+		return err
+	}
+	return t.Conn.Publish(subject, data)
+}
+
+// Subscribe calls handler for every valid document received on subject.
+func (t *NATS) Subscribe(subject string, handler Handler) (Subscription, error) {
+	return t.Conn.Subscribe(subject, func(m *nats.Msg) {
+		var format olnjson.Format
+		if err := json.Unmarshal(m.Data, &format); err != nil {
+			if t.OnError != nil {
+				t.OnError(err)
+			}
+			return
+		}
+		handler(&format)
+	})
+}
+
+// Close flushes pending messages and closes the connection.
+func (t *NATS) Close() error {
+	if err := t.Conn.Flush(); err != nil {
+		t.Conn.Close()
+		return err
+	}
+	t.Conn.Close()
+	return nil
+}
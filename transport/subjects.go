@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/location"
+)
+
+// Prefixes of the subjects derived from a message's tags. Messages are
+// published on these next to the main subject, so nodes that only follow a
+// topic or region can subscribe to just that.
+const (
+	TagPrefix = "oln.tag."
+	GeoPrefix = "oln.geo."
+)
+
+// TagSubject returns the subject for messages with the given hashtag, like
+// oln.tag.oln for #OLN. It returns "" if the tag cannot be a subject token.
+func TagSubject(tag string) string {
+	token := strings.ToLower(strings.TrimPrefix(tag, "#"))
+	if !validToken(token) {
+		return ""
+	}
+	return TagPrefix + token
+}
+
+// GeoSubject returns the subject for messages located in the area of a full
+// plus code: oln.geo.<digits>.<code>, like oln.geo.4.6FG20000+.
+func GeoSubject(code string) (string, error) {
+	levels, err := location.Hierarchy(code)
+	if err != nil {
+		return "", err
+	}
+	return geoSubject(levels[0]), nil
+}
+
+func geoSubject(level location.Level) string {
+	return GeoPrefix + strconv.Itoa(level.Length) + "." + level.Code
+}
+
+// Subjects returns the subjects derived from the tags of a message: one
+// per hashtag and one for every level of the hierarchy of each plus code,
+// so a message at 6FG22222+22 reaches followers of 6FG22200+ too.
+func Subjects(tags []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	add := func(subject string) {
+		if subject != "" && !seen[subject] {
+			seen[subject] = true
+			result = append(result, subject)
+		}
+	}
+
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, "#") {
+			add(TagSubject(tag))
+			continue
+		}
+		levels, err := location.Hierarchy(strings.ToUpper(tag))
+		if err != nil {
+			continue
+		}
+		for _, level := range levels {
+			add(geoSubject(level))
+		}
+	}
+	return result
+}
+
+// validToken reports whether s can be used as a single subject token.
+func validToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	return !strings.ContainsAny(s, ". \t\r\n*>")
+}
@@ -0,0 +1,41 @@
+package transport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchSubject(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		want             bool
+	}{
+		{"oln.messages.v1", "oln.messages.v1", true},
+		{"oln.messages.v1", "oln.messages.v2", false},
+		{"oln.tag.*", "oln.tag.oln", true},
+		{"oln.tag.*", "oln.tag", false},
+		{"oln.tag.*", "oln.tag.oln.x", false},
+		{"oln.>", "oln.geo.2.6F000000+", true},
+		{"oln.>", "oln", false},
+		{"oln.*.v1", "oln.messages.v1", true},
+	}
+	for _, tt := range tests {
+		if got := MatchSubject(tt.pattern, tt.subject); got != tt.want {
+			t.Errorf("MatchSubject(%q, %q) = %v, want %v", tt.pattern, tt.subject, got, tt.want)
+		}
+	}
+}
+
+func TestSubjects(t *testing.T) {
+	got := Subjects([]string{"#OLN", "#oln", "#bad.tag", "6FG22222+", "nonsense"})
+	want := []string{
+		"oln.tag.oln",
+		"oln.geo.8.6FG22222+",
+		"oln.geo.6.6FG22200+",
+		"oln.geo.4.6FG20000+",
+		"oln.geo.2.6F000000+",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Subjects = %v, want %v", got, want)
+	}
+}
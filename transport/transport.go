@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"strings"
+
+	"github.com/lapingvino/eolnpoc/olnjson"
+)
+
+// Handler is called for every OLN document received on a subscription.
+type Handler func(format *olnjson.Format)
+
+// Subscription is an active subscription that can be cancelled.
+type Subscription interface {
+	Unsubscribe() error
+}
+
+// Transport moves OLN documents between nodes. Subjects are dot-separated
+// names like "oln.messages.v1"; subscriptions may use the wildcards "*"
+// for a single token and ">" for all remaining tokens.
+type Transport interface {
+	Publish(subject string, format *olnjson.Format) error
+	Subscribe(subject string, handler Handler) (Subscription, error)
+	Close() error
+}
+
+// MatchSubject reports whether subject matches a subscription pattern.
+func MatchSubject(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
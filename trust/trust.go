@@ -0,0 +1,375 @@
+// Package trust keeps the contact list of a node: origins the user
+// follows, trusts or blocks, under petnames of their choosing. Trust also
+// spreads through attestations, signed messages in which an origin states
+// how much it trusts others, losing half its weight with every step away
+// from the user's own contacts.
+package trust
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/parser"
+	"github.com/lapingvino/eolnpoc/signing"
+)
+
+const (
+	// Trust levels run from 0 to MaxLevel; blocked origins score -MaxLevel.
+	MaxLevel = 100
+
+	// Tag published attestations carry, so nodes can subscribe to them
+	AttestationTag = "#trust"
+
+	// Key of attestation entries: trust:<level>:<pubkey>
+	attestationKey = "trust:"
+
+	// How many attestation steps trust is followed, how many attestations
+	// of one origin are kept and of how many origins
+	maxDepth           = 3
+	maxAttestationsPer = 1000
+	maxAttesters       = 10000
+)
+
+// Contact is what the user decided about an origin.
+type Contact struct {
+	PubKey  string `json:"pubkey"`
+	Petname string `json:"petname,omitempty"`
+	Trust   int    `json:"trust,omitempty"` // 0 to MaxLevel
+	Follow  bool   `json:"follow,omitempty"`
+	Blocked bool   `json:"blocked,omitempty"`
+}
+
+// Attestation is a statement of an origin about another one.
+type Attestation struct {
+	Subject string // Public key trusted
+	Level   int    // 0 to MaxLevel, 0 takes earlier trust back
+	Time    time.Time
+}
+
+// Store holds the contacts, saved to a file if it has a path, and the
+// attestations received, which are kept in memory only. It is safe for
+// concurrent use.
+type Store struct {
+	path         string
+	mu           sync.RWMutex
+	contacts     map[string]*Contact
+	attestations map[string]map[string]Attestation // By attester, then subject
+
+	// reach by number of steps, kept until the contacts or attestations
+	// change. Scores are asked for every message, so it is worth keeping.
+	reachMu sync.Mutex
+	reached map[int]map[string]int
+}
+
+// NewStore returns an empty store that is not saved.
+func NewStore() *Store {
+	return &Store{
+		contacts:     make(map[string]*Contact),
+		attestations: make(map[string]map[string]Attestation),
+	}
+}
+
+// DefaultPath returns where the contact list is kept when none is given.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "oln", "contacts.json"), nil
+}
+
+// Load reads the contact list at path. A missing file gives an empty
+// store that is created on the first change.
+func Load(path string) (*Store, error) {
+	s := NewStore()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var contacts []*Contact
+	if err := json.Unmarshal(data, &contacts); err != nil {
+		return nil, fmt.Errorf("invalid contact list %s: %v", path, err)
+	}
+	for _, c := range contacts {
+		s.contacts[c.PubKey] = c
+	}
+	return s, nil
+}
+
+// save writes the contacts to the file of the store. Callers must hold
+// s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, append(data, '\n'), 0600)
+}
+
+// Set stores c, replacing what was known about its public key.
+func (s *Store) Set(c Contact) error {
+	if _, err := signing.DecodePubKey(c.PubKey); err != nil {
+		return err
+	}
+	if c.Trust < 0 || c.Trust > MaxLevel {
+		return fmt.Errorf("trust level out of range 0-%d: %d", MaxLevel, c.Trust)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contacts[c.PubKey] = &c
+	s.reached = nil
+	return s.save()
+}
+
+// Remove forgets a contact and reports whether it was known.
+func (s *Store) Remove(pubKey string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.contacts[pubKey]; !ok {
+		return false, nil
+	}
+	delete(s.contacts, pubKey)
+	s.reached = nil
+	return true, s.save()
+}
+
+// Get returns the contact with the given public key.
+func (s *Store) Get(pubKey string) (Contact, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.contacts[pubKey]
+	if !ok {
+		return Contact{}, false
+	}
+	return *c, true
+}
+
+// Resolve returns the public key a petname stands for, or key itself if it
+// is a public key.
+func (s *Store) Resolve(key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.contacts {
+		if c.Petname != "" && c.Petname == key {
+			return c.PubKey, nil
+		}
+	}
+	if _, err := signing.DecodePubKey(key); err != nil {
+		return "", fmt.Errorf("not a petname or public key: %s", key)
+	}
+	return key, nil
+}
+
+// Contacts returns all contacts sorted by petname, then public key.
+func (s *Store) Contacts() []Contact {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []Contact
+	for _, c := range s.list() {
+		result = append(result, *c)
+	}
+	return result
+}
+
+func (s *Store) list() []*Contact {
+	list := make([]*Contact, 0, len(s.contacts))
+	for _, c := range s.contacts {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Petname != list[j].Petname {
+			return list[i].Petname < list[j].Petname
+		}
+		return list[i].PubKey < list[j].PubKey
+	})
+	return list
+}
+
+// Score returns how much pubKey is trusted: -MaxLevel if it is blocked,
+// the level given to it if it is a trusted contact, or else the best trust
+// reaching it through attestations of trusted origins. Every step halves
+// the trust and weighs it by the attested level.
+func (s *Store) Score(pubKey string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if c, ok := s.contacts[pubKey]; ok {
+		if c.Blocked {
+			return -MaxLevel
+		}
+		if c.Trust > 0 {
+			return c.Trust
+		}
+	}
+	return s.cachedReach(maxDepth)[pubKey]
+}
+
+// cachedReach returns reach(steps), computing it only once between
+// changes. Callers must hold s.mu; changes must clear s.reached under it.
+func (s *Store) cachedReach(steps int) map[string]int {
+	s.reachMu.Lock()
+	defer s.reachMu.Unlock()
+
+	if best, ok := s.reached[steps]; ok {
+		return best
+	}
+	if s.reached == nil {
+		s.reached = make(map[int]map[string]int)
+	}
+	best := s.reach(steps)
+	s.reached[steps] = best
+	return best
+}
+
+// reach returns the best trust in every origin that trust reaches within
+// steps attestations, including the trusted contacts themselves. Callers
+// must hold s.mu.
+func (s *Store) reach(steps int) map[string]int {
+	frontier := make(map[string]int)
+	for key, c := range s.contacts {
+		if c.Trust > 0 && !c.Blocked {
+			frontier[key] = c.Trust
+		}
+	}
+
+	best := make(map[string]int, len(frontier))
+	for key, score := range frontier {
+		best[key] = score
+	}
+	for depth := 0; depth < steps && len(frontier) > 0; depth++ {
+		next := make(map[string]int)
+		for attester, score := range frontier {
+			for subject, a := range s.attestations[attester] {
+				if c, ok := s.contacts[subject]; ok && (c.Blocked || c.Trust > 0) {
+					continue
+				}
+				value := score * a.Level / MaxLevel / 2
+				if value > next[subject] {
+					next[subject] = value
+				}
+			}
+		}
+		for key, score := range next {
+			if score > best[key] {
+				best[key] = score
+			}
+		}
+		frontier = next
+	}
+	return best
+}
+
+// Follows reports whether pubKey is followed.
+func (s *Store) Follows(pubKey string) bool {
+	c, ok := s.Get(pubKey)
+	return ok && c.Follow && !c.Blocked
+}
+
+// Attest records the attestations of attester, keeping the newest one per
+// subject. Only attesters that can pass on trust count: trusted contacts
+// and the origins trust reaches from them in fewer than maxDepth steps.
+// Attestations of anyone else are ignored. It reports whether anything
+// changed.
+func (s *Store) Attest(attester string, attestations []Attestation) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cachedReach(maxDepth - 1)[attester] <= 0 {
+		return false
+	}
+	known := s.attestations[attester]
+	if known == nil {
+		if len(s.attestations) >= maxAttesters {
+			return false
+		}
+		known = make(map[string]Attestation)
+		s.attestations[attester] = known
+	}
+
+	changed := false
+	for _, a := range attestations {
+		if a.Subject == attester {
+			continue
+		}
+		old, ok := known[a.Subject]
+		if ok && !a.Time.After(old.Time) {
+			continue
+		}
+		if !ok && len(known) >= maxAttestationsPer {
+			continue
+		}
+		known[a.Subject] = a
+		changed = true
+	}
+	if changed {
+		s.reached = nil
+	}
+	return changed
+}
+
+// Attestations returns what attester said about others, by subject.
+func (s *Store) Attestations(attester string) map[string]Attestation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]Attestation, len(s.attestations[attester]))
+	for subject, a := range s.attestations[attester] {
+		result[subject] = a
+	}
+	return result
+}
+
+// FormatAttestation returns the text of a message attesting that pubKey is
+// trusted at level, for publishing.
+func FormatAttestation(pubKey string, level int) string {
+	return fmt.Sprintf("%s %s%d:%s", AttestationTag, attestationKey, level, pubKey)
+}
+
+// ParseAttestations returns the attestations in the text of a message
+// sent at t: every trust:<level>:<pubkey> entry with a valid level and key.
+func ParseAttestations(text string, t time.Time) []Attestation {
+	var result []Attestation
+	for _, e := range parser.Parse(text) {
+		if e.Kind != parser.Key || !strings.HasPrefix(e.Value, attestationKey) {
+			continue
+		}
+		levelText, pubKey, ok := strings.Cut(strings.TrimPrefix(e.Value, attestationKey), ":")
+		if !ok {
+			continue
+		}
+		level, err := strconv.Atoi(levelText)
+		if err != nil || level < 0 || level > MaxLevel {
+			continue
+		}
+		if _, err := signing.DecodePubKey(pubKey); err != nil {
+			continue
+		}
+		result = append(result, Attestation{Subject: pubKey, Level: level, Time: t})
+	}
+	return result
+}
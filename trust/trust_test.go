@@ -0,0 +1,179 @@
+package trust
+
+import (
+	"crypto/ed25519"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lapingvino/eolnpoc/signing"
+)
+
+func newKeys(t *testing.T, n int) []string {
+	t.Helper()
+	keys := make([]string, n)
+	for i := range keys {
+		key, err := signing.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = signing.EncodePubKey(key.Public().(ed25519.PublicKey))
+	}
+	return keys
+}
+
+func attest(s *Store, attester, subject string, level int) bool {
+	return s.Attest(attester, []Attestation{{Subject: subject, Level: level, Time: time.Now()}})
+}
+
+// TestScoreDecay checks that trust halves with every attestation step,
+// weighed by the attested level, and stops after maxDepth steps.
+func TestScoreDecay(t *testing.T) {
+	keys := newKeys(t, 6)
+	contact, first, second, third, fourth, half := keys[0], keys[1], keys[2], keys[3], keys[4], keys[5]
+
+	s := NewStore()
+	if err := s.Set(Contact{PubKey: contact, Trust: 80}); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []struct {
+		attester, subject string
+		level             int
+	}{
+		{contact, first, MaxLevel},
+		{contact, half, MaxLevel / 2},
+		{first, second, MaxLevel},
+		{second, third, MaxLevel},
+		{third, fourth, MaxLevel},
+	} {
+		attest(s, a.attester, a.subject, a.level)
+	}
+
+	for _, tt := range []struct {
+		key  string
+		want int
+	}{
+		{contact, 80},
+		{first, 40},
+		{half, 20},
+		{second, 20},
+		{third, 10},
+		{fourth, 0}, // Four steps away
+	} {
+		if got := s.Score(tt.key); got != tt.want {
+			t.Errorf("Score(%s) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+
+	// The best path wins
+	attest(s, contact, second, MaxLevel)
+	if got := s.Score(second); got != 40 {
+		t.Errorf("Score over the shorter path = %d, want 40", got)
+	}
+}
+
+func TestBlockedOverridesAttestations(t *testing.T) {
+	keys := newKeys(t, 4)
+	contact, blocked, beyond, own := keys[0], keys[1], keys[2], keys[3]
+
+	s := NewStore()
+	s.Set(Contact{PubKey: contact, Trust: MaxLevel})
+	attest(s, contact, blocked, MaxLevel)
+	attest(s, blocked, beyond, MaxLevel)
+	attest(s, contact, own, MaxLevel)
+	if got := s.Score(beyond); got != 25 {
+		t.Fatalf("Score before blocking = %d, want 25", got)
+	}
+
+	s.Set(Contact{PubKey: blocked, Blocked: true})
+	if got := s.Score(blocked); got != -MaxLevel {
+		t.Errorf("Score(blocked) = %d, want %d", got, -MaxLevel)
+	}
+	if got := s.Score(beyond); got != 0 {
+		t.Errorf("trust passed on by a blocked origin: %d", got)
+	}
+
+	// The level set by the user wins over attestations too
+	s.Set(Contact{PubKey: own, Trust: 10})
+	if got := s.Score(own); got != 10 {
+		t.Errorf("Score(own) = %d, want 10", got)
+	}
+}
+
+// TestAttestOnlyReachable checks that attestations of origins trust does
+// not reach, or reaches too far away to pass on, are not kept.
+func TestAttestOnlyReachable(t *testing.T) {
+	keys := newKeys(t, 6)
+	contact, stranger, first, second, third, target := keys[0], keys[1], keys[2], keys[3], keys[4], keys[5]
+
+	s := NewStore()
+	s.Set(Contact{PubKey: contact, Trust: MaxLevel})
+
+	if attest(s, stranger, target, MaxLevel) {
+		t.Error("stranger's attestation kept")
+	}
+	if len(s.Attestations(stranger)) != 0 {
+		t.Error("stranger's attestations stored")
+	}
+
+	if !attest(s, contact, first, MaxLevel) || !attest(s, first, second, MaxLevel) || !attest(s, second, third, MaxLevel) {
+		t.Fatal("attestations within reach not kept")
+	}
+	if attest(s, third, target, MaxLevel) {
+		t.Errorf("attestation %d steps away kept", maxDepth)
+	}
+
+	// Level 0 reaches nobody
+	attest(s, contact, stranger, 0)
+	if attest(s, stranger, target, MaxLevel) {
+		t.Error("attestation of an origin attested at level 0 kept")
+	}
+}
+
+// TestScoreCached checks that the reach of trust is computed once and
+// recomputed after every change, also while scores are asked concurrently.
+func TestScoreCached(t *testing.T) {
+	keys := newKeys(t, 3)
+	contact, first, second := keys[0], keys[1], keys[2]
+
+	s := NewStore()
+	s.Set(Contact{PubKey: contact, Trust: MaxLevel})
+	attest(s, contact, first, MaxLevel)
+	if got := s.Score(first); got != 50 {
+		t.Fatalf("Score(first) = %d, want 50", got)
+	}
+	if s.reached[maxDepth] == nil {
+		t.Error("reach not kept after Score")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Score(second)
+			}
+		}()
+	}
+	attest(s, first, second, MaxLevel)
+	wg.Wait()
+	if got := s.Score(second); got != 25 {
+		t.Errorf("Score(second) after attesting = %d, want 25", got)
+	}
+
+	s.Remove(contact)
+	if got := s.Score(first); got != 0 {
+		t.Errorf("Score(first) after removing the contact = %d, want 0", got)
+	}
+}
+
+func TestParseAttestations(t *testing.T) {
+	keys := newKeys(t, 1)
+	now := time.Now()
+	text := FormatAttestation(keys[0], 70) + " trust:101:" + keys[0] + " trust:50:nokey"
+	got := ParseAttestations(text, now)
+	if len(got) != 1 || got[0] != (Attestation{Subject: keys[0], Level: 70, Time: now}) {
+		t.Errorf("ParseAttestations = %+v", got)
+	}
+}